@@ -0,0 +1,204 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLog
+// --------------------------------
+
+// AccessLogField selects a field to add to the access log records.
+// Combine them with "|".
+type AccessLogField int
+
+// The fields AccessLog can add to its records.
+const (
+	LogMethod AccessLogField = 1 << iota
+	LogPath
+	LogRoute
+	LogParams
+	LogStatus
+	LogBytes
+	LogLatency
+	LogRemoteAddr
+	LogRequestID
+	LogUserAgent
+	LogReferer
+)
+
+// DefaultAccessLogFields are the fields logged when none are selected.
+const DefaultAccessLogFields = LogMethod | LogPath | LogRoute | LogParams | LogStatus |
+	LogBytes | LogLatency | LogRemoteAddr | LogRequestID
+
+// AccessLogOptions configures the AccessLog handler.
+type AccessLogOptions struct {
+	Logger      *slog.Logger   // Logger receiving the records, defaults to slog.Default()
+	Fields      AccessLogField // Fields to add to the records, defaults to DefaultAccessLogFields
+	SampleRate  float64        // Fraction of the requests to log, 0 logs all of them
+	CombinedLog io.Writer      // Write lines in the Combined Log Format here instead of using Logger
+}
+
+// AccessLog returns a HandlerFunc logging a line for each request once
+// the handlers after it are done. Mount it first so it sees every request.
+//
+//	appRouter.Mount("/", router.AccessLog(router.AccessLogOptions{}))
+//
+// Records are emitted with log/slog at the info level, or at the error
+// level when the response is a server error. Set CombinedLog to write
+// lines in the Combined Log Format instead.
+//
+// When sampling, server errors are always logged.
+func AccessLog(options AccessLogOptions) http.HandlerFunc {
+	if options.Fields == 0 {
+		options.Fields = DefaultAccessLogFields
+	}
+	var lock sync.Mutex
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		cntxt := Context(req)
+
+		cntxt.Next(res, req)
+
+		latency := time.Since(start)
+		status := cntxt.Response().Status()
+		if status == 0 {
+			// Nothing has been written, go will respond with a 200
+			status = http.StatusOK
+		}
+
+		if !isSampled(options.SampleRate, status) {
+			return
+		}
+
+		if options.CombinedLog != nil {
+			line := combinedLogLine(cntxt, req, status, start)
+			lock.Lock()
+			io.WriteString(options.CombinedLog, line)
+			lock.Unlock()
+			return
+		}
+
+		logger := options.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(req.Context(), level, "request", accessLogAttrs(options.Fields, cntxt, req, status, latency)...)
+	}
+}
+
+// Decides whether to log a request given the sample rate.
+func isSampled(sampleRate float64, status int) bool {
+	if sampleRate <= 0 || sampleRate >= 1 || status >= 500 {
+		return true
+	}
+	return rand.Float64() < sampleRate
+}
+
+// Builds the attributes of the slog record for the selected fields.
+func accessLogAttrs(fields AccessLogField, cntxt *RequestContext, req *http.Request, status int, latency time.Duration) []slog.Attr {
+	attrs := make([]slog.Attr, 0, 12)
+	if fields&LogMethod != 0 {
+		attrs = append(attrs, slog.String("method", req.Method))
+	}
+	if fields&LogPath != 0 {
+		attrs = append(attrs, slog.String("path", req.URL.Path))
+	}
+	if fields&LogRoute != 0 {
+		attrs = append(attrs, slog.String("route", cntxt.Route()))
+	}
+	if fields&LogParams != 0 && len(cntxt.params) != 0 {
+		params := make([]any, 0, len(cntxt.params))
+		for _, param := range cntxt.params {
+			params = append(params, slog.String(param.Name, param.Value))
+		}
+		attrs = append(attrs, slog.Group("params", params...))
+	}
+	if fields&LogStatus != 0 {
+		attrs = append(attrs, slog.Int("status", status))
+	}
+	if fields&LogBytes != 0 {
+		attrs = append(attrs, slog.Int("bytes", cntxt.Response().Size()))
+	}
+	if fields&LogLatency != 0 {
+		attrs = append(attrs, slog.Duration("latency", latency))
+	}
+	if fields&LogRemoteAddr != 0 {
+		attrs = append(attrs, slog.String("remote_addr", req.RemoteAddr))
+	}
+	if fields&LogRequestID != 0 {
+		if id := accessLogRequestID(cntxt, req); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+	}
+	if fields&LogUserAgent != 0 {
+		attrs = append(attrs, slog.String("user_agent", req.UserAgent()))
+	}
+	if fields&LogReferer != 0 {
+		attrs = append(attrs, slog.String("referer", req.Referer()))
+	}
+	if cntxt.TimedOut() {
+		attrs = append(attrs, slog.Bool("timed_out", true))
+	}
+	return attrs
+}
+
+// Returns the request ID as set by the RequestID handler, falling back
+// to the one echoed in the response or sent by the client.
+func accessLogRequestID(cntxt *RequestContext, req *http.Request) string {
+	if id := cntxt.RequestID(); id != "" {
+		return id
+	}
+	if id := cntxt.Response().Header().Get("X-Request-ID"); id != "" {
+		return id
+	}
+	return req.Header.Get("X-Request-ID")
+}
+
+// Formats a line in the Combined Log Format:
+//
+//	host ident authuser [date] "request line" status bytes "referer" "user-agent"
+func combinedLogLine(cntxt *RequestContext, req *http.Request, status int, start time.Time) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	user := "-"
+	if username, _, ok := req.BasicAuth(); ok && username != "" {
+		user = username
+	}
+	size := "-"
+	if n := cntxt.Response().Size(); n > 0 {
+		size = strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s %q %q\n",
+		orDash(host),
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		req.Method, req.URL.RequestURI(), req.Proto,
+		status,
+		size,
+		orDash(req.Referer()),
+		orDash(req.UserAgent()),
+	)
+}
+
+// Combined Log Format uses a dash for missing values.
+func orDash(val string) string {
+	if val == "" {
+		return "-"
+	}
+	return val
+}
@@ -0,0 +1,131 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", AccessLog(AccessLogOptions{Logger: logger}))
+	aRouter.Get("/user/:userid", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("user " + Context(req).Params["userid"]))
+	})
+	aRouter.Get("/error", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Error(res, req, "oops", 500)
+	})
+
+	req, _ := http.NewRequest("GET", "/user/14", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Request-ID", "abc")
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal("Expected a JSON record got ", buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"level":       "INFO",
+		"msg":         "request",
+		"method":      "GET",
+		"path":        "/user/14",
+		"route":       "/user/:userid",
+		"status":      float64(200),
+		"bytes":       float64(7),
+		"remote_addr": "10.0.0.1:1234",
+		"request_id":  "abc",
+	}
+	for key, val := range expected {
+		if record[key] != val {
+			t.Error("Expected ", key, " to be ", val, " got ", record[key])
+		}
+	}
+	if params, ok := record["params"].(map[string]interface{}); !ok || params["userid"] != "14" {
+		t.Error("Expected the params to be logged got ", record["params"])
+	}
+	if _, ok := record["latency"]; !ok {
+		t.Error("Expected the latency to be logged")
+	}
+
+	// Server errors are logged as errors
+	buf.Reset()
+	req, _ = http.NewRequest("GET", "/error", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), `"level":"ERROR"`) ||
+		!strings.Contains(buf.String(), `"status":500`) {
+		t.Error("Expected an error record got ", buf.String())
+	}
+}
+
+func TestAccessLogFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", AccessLog(AccessLogOptions{Logger: logger, Fields: LogRoute | LogStatus}))
+	aRouter.Get("/hello", func(res http.ResponseWriter, req *http.Request) {})
+
+	req, _ := http.NewRequest("GET", "/hello", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]interface{}
+	json.Unmarshal(buf.Bytes(), &record)
+
+	if len(record) != 5 || record["route"] != "/hello" || record["status"] != float64(200) {
+		t.Error("Expected only the route and status to be logged got ", record)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", AccessLog(AccessLogOptions{Logger: logger, SampleRate: 0.000001}))
+	aRouter.Get("/hello", func(res http.ResponseWriter, req *http.Request) {})
+	aRouter.Get("/error", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(503)
+	})
+
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest("GET", "/hello", nil)
+		aRouter.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req, _ := http.NewRequest("GET", "/error", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 1 || !strings.Contains(buf.String(), "status=503") {
+		t.Error("Expected only the server error to be logged got ", buf.String())
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", AccessLog(AccessLogOptions{CombinedLog: &buf}))
+	aRouter.Get("/hello", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("hello"))
+	})
+
+	req, _ := http.NewRequest("GET", "/hello?name=richard", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := regexp.MustCompile(`^10\.0\.0\.1 - - \[[^\]]+\] "GET /hello\?name=richard HTTP/1\.1" 200 5 "-" "test-agent"\n$`)
+	if !line.MatchString(buf.String()) {
+		t.Error("Expected a line in the Combined Log Format got ", buf.String())
+	}
+}
@@ -0,0 +1,191 @@
+package router
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Auth
+// --------------------------------
+
+// Principal is the authenticated client making the request.
+type Principal struct {
+	Name   string   // Name of the user or client
+	Scopes []string // Scopes the client has been granted
+}
+
+// HasScope reports whether the principal has been granted the scope.
+func (principal *Principal) HasScope(scope string) bool {
+	return principal != nil && containsString(principal.Scopes, scope)
+}
+
+// Principal returns the client authenticated by one of the auth handlers,
+// nil when the request has not been authenticated.
+func (cntxt *RequestContext) Principal() *Principal {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	return cntxt.principal
+}
+
+// SetPrincipal stores the authenticated client for the request. The auth
+// handlers call it, use it when writing your own.
+func (cntxt *RequestContext) SetPrincipal(principal *Principal) {
+	cntxt.lock.Lock()
+	cntxt.principal = principal
+	cntxt.lock.Unlock()
+}
+
+// BasicAuthOptions configures the BasicAuth handler.
+type BasicAuthOptions struct {
+	Realm    string                                             // Realm sent to the client, defaults to "Restricted"
+	Users    map[string]string                                  // Passwords by username
+	Validate func(username, password string) (*Principal, bool) // Validates credentials instead of Users
+}
+
+// BasicAuth returns a HandlerFunc only letting requests with valid
+// HTTP Basic credentials through.
+//
+//	appRouter.Mount("/admin", router.BasicAuth(router.BasicAuthOptions{
+//		Users: map[string]string{"richard": "secret"},
+//	}))
+//
+// Passwords are compared in constant time. The principal is stored
+// in the requestContext, its Name being the username. Requests without
+// valid credentials get a 401 generated by the ErrorHandler.
+func BasicAuth(options BasicAuthOptions) http.HandlerFunc {
+	if options.Realm == "" {
+		options.Realm = "Restricted"
+	}
+	challenge := "Basic realm=" + strconv.Quote(options.Realm) + `, charset="UTF-8"`
+
+	validate := options.Validate
+	if validate == nil {
+		validate = func(username, password string) (*Principal, bool) {
+			expected, ok := options.Users[username]
+			// Compare anyway, not to reveal which users exist
+			if !secureCompare(password, expected) || !ok {
+				return nil, false
+			}
+			return &Principal{Name: username}, true
+		}
+	}
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		username, password, ok := req.BasicAuth()
+		if !ok {
+			unauthorized(res, req, challenge)
+			return
+		}
+		principal, ok := validate(username, password)
+		if !ok {
+			unauthorized(res, req, challenge)
+			return
+		}
+		cntxt.SetPrincipal(principal)
+		cntxt.Next(res, req)
+	}
+}
+
+// TokenValidator validates a bearer token, returning the principal it
+// was issued to or an error when the token is not valid.
+type TokenValidator func(ctx context.Context, token string) (*Principal, error)
+
+// BearerAuthOptions configures the BearerAuth handler.
+type BearerAuthOptions struct {
+	Realm    string         // Realm sent to the client, defaults to "Restricted"
+	Validate TokenValidator // Validates the tokens
+}
+
+// BearerAuth returns a HandlerFunc only letting requests with a valid
+// bearer token in the Authorization header through.
+//
+//	appRouter.Mount("/api", router.BearerAuth(router.BearerAuthOptions{
+//		Validate: lookupToken,
+//	}))
+//
+// The principal returned by Validate is stored in the requestContext.
+// Requests without a valid token get a 401 generated by the ErrorHandler.
+func BearerAuth(options BearerAuthOptions) http.HandlerFunc {
+	if options.Validate == nil {
+		panic("router: BearerAuth needs Validate to validate tokens with")
+	}
+	if options.Realm == "" {
+		options.Realm = "Restricted"
+	}
+	realm := "Bearer realm=" + strconv.Quote(options.Realm)
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		token, ok := bearerToken(req)
+		if !ok {
+			unauthorized(res, req, realm)
+			return
+		}
+		principal, err := options.Validate(req.Context(), token)
+		if err != nil || principal == nil {
+			unauthorized(res, req, realm+`, error="invalid_token"`)
+			return
+		}
+		cntxt.SetPrincipal(principal)
+		cntxt.Next(res, req)
+	}
+}
+
+// RequireScopes returns a HandlerFunc only letting requests through when
+// the principal has been granted all scopes. Register it on the routes
+// needing them, after an auth handler has run.
+//
+//	appRouter.Mount("/api", router.BearerAuth(options))
+//	appRouter.Delete("/api/user/:userid", router.RequireScopes("users:write"), deleteUser)
+//
+// Unauthenticated requests get a 401 challenging them for a bearer token,
+// requests lacking a scope a 403, both generated by the ErrorHandler.
+func RequireScopes(scopes ...string) http.HandlerFunc {
+	required := strings.Join(scopes, " ")
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		principal := cntxt.Principal()
+		if principal == nil {
+			unauthorized(res, req, `Bearer realm="Restricted"`)
+			return
+		}
+		for _, scope := range scopes {
+			if !principal.HasScope(scope) {
+				res.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope=`+strconv.Quote(required))
+				cntxt.Error(res, req, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+		cntxt.Next(res, req)
+	}
+}
+
+// Returns the bearer token from the Authorization header.
+func bearerToken(req *http.Request) (string, bool) {
+	auth := req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(auth[7:])
+	return token, token != ""
+}
+
+// Responds with a 401 and the challenge telling the client how to authenticate.
+func unauthorized(res http.ResponseWriter, req *http.Request, challenge string) {
+	res.Header().Set("WWW-Authenticate", challenge)
+	Context(req).Error(res, req, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// Compares the strings in constant time. Hashing them first
+// prevents leaking their length.
+func secureCompare(given, expected string) bool {
+	givenHash := sha256.Sum256([]byte(given))
+	expectedHash := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(givenHash[:], expectedHash[:]) == 1
+}
@@ -0,0 +1,131 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/admin", BasicAuth(BasicAuthOptions{
+		Realm: "Admin",
+		Users: map[string]string{"richard": "secret"},
+	}))
+
+	var principal *Principal
+	aRouter.Get("/admin", func(res http.ResponseWriter, req *http.Request) {
+		principal = Context(req).Principal()
+	})
+
+	type testPair struct {
+		username, password string
+		expected           int
+	}
+
+	testPairs := []testPair{
+		{"", "", http.StatusUnauthorized},
+		{"richard", "secret", http.StatusOK},
+		{"richard", "wrong", http.StatusUnauthorized},
+		{"unknown", "secret", http.StatusUnauthorized},
+		{"unknown", "", http.StatusUnauthorized},
+	}
+
+	for _, test := range testPairs {
+		principal = nil
+		req, _ := http.NewRequest("GET", "/admin", nil)
+		if test.username != "" {
+			req.SetBasicAuth(test.username, test.password)
+		}
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.expected {
+			t.Error("Expected ", test.expected, " got ", res.Code, " for ", test.username, test.password)
+		}
+		if test.expected == http.StatusUnauthorized && res.Header().Get("WWW-Authenticate") != `Basic realm="Admin", charset="UTF-8"` {
+			t.Error("Expected a challenge got ", res.Header().Get("WWW-Authenticate"))
+		}
+		if test.expected == http.StatusOK && (principal == nil || principal.Name != "richard") {
+			t.Error("Expected the principal to be stored got ", principal)
+		}
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", BearerAuth(BearerAuthOptions{
+		Validate: func(ctx context.Context, token string) (*Principal, error) {
+			if token != "valid-token" {
+				return nil, errors.New("unknown token")
+			}
+			return &Principal{Name: "client", Scopes: []string{"users:read"}}, nil
+		},
+	}))
+	aRouter.Get("/users", RequireScopes("users:read"), func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(Context(req).Principal().Name))
+	})
+	aRouter.Delete("/users", RequireScopes("users:read", "users:write"), func(res http.ResponseWriter, req *http.Request) {
+		t.Error("Expected the handler not to be called")
+	})
+
+	type testPair struct {
+		method, authorization string
+		expected              int
+		challenge             string
+	}
+
+	testPairs := []testPair{
+		{"GET", "", http.StatusUnauthorized, `Bearer realm="Restricted"`},
+		{"GET", "Basic abc", http.StatusUnauthorized, `Bearer realm="Restricted"`},
+		{"GET", "Bearer other-token", http.StatusUnauthorized, `Bearer realm="Restricted", error="invalid_token"`},
+		{"GET", "Bearer valid-token", http.StatusOK, ""},
+		{"GET", "bearer valid-token", http.StatusOK, ""},
+		{"DELETE", "Bearer valid-token", http.StatusForbidden, `Bearer error="insufficient_scope", scope="users:read users:write"`},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest(test.method, "/users", nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.expected {
+			t.Error("Expected ", test.expected, " got ", res.Code, " for ", test.method, test.authorization)
+		}
+		if challenge := res.Header().Get("WWW-Authenticate"); challenge != test.challenge {
+			t.Error("Expected challenge ", test.challenge, " got ", challenge)
+		}
+		if test.expected == http.StatusOK && res.Body.String() != "client" {
+			t.Error("Expected the principal to be stored got ", res.Body.String())
+		}
+	}
+}
+
+func TestRequireScopesUnauthenticated(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Get("/", RequireScopes("admin"), func(res http.ResponseWriter, req *http.Request) {
+		t.Error("Expected the handler not to be called")
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnauthorized || res.Header().Get("WWW-Authenticate") != `Bearer realm="Restricted"` {
+		t.Error("Expected a 401 with a challenge got ", res.Code, " ", res.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestBearerAuthWithoutValidate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected BearerAuth without Validate to panic")
+		}
+	}()
+	BearerAuth(BearerAuthOptions{})
+}
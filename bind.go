@@ -0,0 +1,471 @@
+package router
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Binding
+// --------------------------------
+
+// FieldError describes why a field could not be bound.
+type FieldError struct {
+	Source  string `json:"source"` // Where the value comes from: "path", "query", "header" or "form"
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (err FieldError) Error() string {
+	return err.Source + " " + strconv.Quote(err.Name) + " " + err.Message
+}
+
+// FieldErrors reports all the fields which could not be bound.
+type FieldErrors []FieldError
+
+func (errs FieldErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Bind fills the struct v points to with values from the request and
+// validates them. When it can't, the ErrorHandler responds with a 400
+// listing the fields in error and false is returned, so the handler
+// can simply return.
+//
+//	type ListUsers struct {
+//		Team   string    `path:"teamid" validate:"required"`
+//		Tenant string    `header:"X-Tenant"`
+//		Page   int       `query:"page" validate:"min=1"`
+//		Sort   string    `query:"sort" validate:"oneof=name age"`
+//		Tags   []string  `query:"tag" validate:"max=5,regex=^[a-z]+$"`
+//		Since  time.Time `query:"since" layout:"2006-01-02"`
+//	}
+//
+//	var params ListUsers
+//	if !cntxt.Bind(res, req, &params) {
+//		return
+//	}
+//
+// Fields are filled from the path params, the query, the headers or the
+// form in the request body, as named by their tag. Fields without such
+// a tag are left alone, so are the fields for which the request holds no
+// value. Fields can be strings, booleans, numbers, time.Durations,
+// time.Times parsed with their layout tag (time.RFC3339 by default),
+// encoding.TextUnmarshalers, pointers to these, or slices of these
+// filled from repeated values.
+//
+// The validate tag holds comma separated rules:
+//   - required: the request must hold a value.
+//   - min=n, max=n: numbers must be at least, at most n, strings must be
+//     as many characters long and slices hold as many values.
+//   - oneof=a b c: the value must be one of the space separated values.
+//   - regex=pattern: the value must match the pattern. Being able to
+//     hold commas, it must be the last rule.
+//
+// Rules are checked against values found in the request, and against each
+// value of slices for oneof and regex. Use `cntxt.FieldErrors()` in the
+// ErrorHandler to render the fields in error yourself.
+//
+// Invalid tags are mistakes in the code, Bind panics on them.
+func (cntxt *RequestContext) Bind(res http.ResponseWriter, req *http.Request, v interface{}) bool {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Struct {
+		panic("router: Bind needs a pointer to a struct")
+	}
+	target = target.Elem()
+	fields := bindFieldsOf(target.Type())
+
+	for _, field := range fields {
+		if field.source == "form" {
+			if code := parseForm(req); code != 0 {
+				cntxt.Error(res, req, http.StatusText(code), code)
+				return false
+			}
+			break
+		}
+	}
+
+	var errs FieldErrors
+	for _, field := range fields {
+		values := field.values(cntxt, req)
+		value := target.Field(field.index)
+		if len(values) == 0 {
+			if field.required {
+				errs = append(errs, FieldError{field.source, field.name, "is required"})
+			}
+			continue
+		}
+		if message := field.set(value, values); message != "" {
+			errs = append(errs, FieldError{field.source, field.name, message})
+			continue
+		}
+		if message := field.validate(value); message != "" {
+			errs = append(errs, FieldError{field.source, field.name, message})
+		}
+	}
+
+	if errs != nil {
+		cntxt.lock.Lock()
+		cntxt.fieldErrors = errs
+		cntxt.lock.Unlock()
+		cntxt.Error(res, req, errs.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// FieldErrors returns the fields Bind could not bind, to render them
+// in the ErrorHandler.
+func (cntxt *RequestContext) FieldErrors() FieldErrors {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	return cntxt.fieldErrors
+}
+
+// The sources values are bound from, in the order they are looked for.
+var bindSources = []string{"path", "query", "header", "form"}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// A field of a struct to bind, as described by its tags.
+type bindField struct {
+	index    int
+	source   string
+	name     string
+	layout   string
+	required bool
+	min      *float64
+	max      *float64
+	oneOf    []string
+	regex    *regexp.Regexp
+}
+
+// Fields of the struct types bound so far, by type.
+var bindFieldsCache sync.Map
+
+// Returns the fields to bind of the struct type.
+func bindFieldsOf(structType reflect.Type) []bindField {
+	if fields, ok := bindFieldsCache.Load(structType); ok {
+		return fields.([]bindField)
+	}
+
+	var fields []bindField
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		field := bindField{index: i, layout: time.RFC3339}
+		for _, source := range bindSources {
+			if name, ok := structField.Tag.Lookup(source); ok {
+				field.source, field.name = source, name
+				break
+			}
+		}
+		if field.source == "" {
+			continue
+		}
+		if !structField.IsExported() {
+			panic(fmt.Sprintf("router: can't bind unexported field %s", structField.Name))
+		}
+		if !isBindable(structField.Type) {
+			panic(fmt.Sprintf("router: can't bind field %s of type %s", structField.Name, structField.Type))
+		}
+		if layout, ok := structField.Tag.Lookup("layout"); ok {
+			field.layout = layout
+		}
+		if err := field.parseRules(structField.Tag.Get("validate"), structField.Type); err != nil {
+			panic(fmt.Sprintf("router: invalid validate tag of field %s: %v", structField.Name, err))
+		}
+		fields = append(fields, field)
+	}
+
+	bindFieldsCache.Store(structType, fields)
+	return fields
+}
+
+// Reports whether values can be bound to fields of the type.
+func isBindable(fieldType reflect.Type) bool {
+	if isTextType(fieldType) {
+		return true
+	}
+	if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	if isTextType(fieldType) {
+		return true
+	}
+	switch fieldType.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func (field *bindField) parseRules(tag string, fieldType reflect.Type) error {
+	for tag != "" {
+		rule := tag
+		if strings.HasPrefix(tag, "regex=") {
+			// Patterns may hold commas
+			tag = ""
+		} else if i := strings.Index(tag, ","); i != -1 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			field.required = true
+		case "min", "max":
+			if !hasSize(fieldType) {
+				return fmt.Errorf("%s does not apply to %s", name, fieldType)
+			}
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("%s needs a number", name)
+			}
+			if name == "min" {
+				field.min = &n
+			} else {
+				field.max = &n
+			}
+		case "oneof":
+			field.oneOf = strings.Fields(arg)
+		case "regex":
+			regex, err := regexp.Compile(arg)
+			if err != nil {
+				return err
+			}
+			field.regex = regex
+		default:
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return nil
+}
+
+// Reports whether values of the type are parsed from text as a whole,
+// like time.Time and net.IP.
+func isTextType(fieldType reflect.Type) bool {
+	return fieldType == timeType || reflect.PtrTo(fieldType).Implements(textUnmarshalerType)
+}
+
+// Reports whether min and max apply to values of the type.
+func hasSize(fieldType reflect.Type) bool {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType == durationType || isTextType(fieldType) {
+		return false
+	}
+	return fieldType.Kind() != reflect.Bool
+}
+
+// Returns the values of the field found in the request.
+func (field *bindField) values(cntxt *RequestContext, req *http.Request) []string {
+	switch field.source {
+	case "path":
+		return cntxt.params.Values(field.name)
+	case "query":
+		return req.URL.Query()[field.name]
+	case "header":
+		return req.Header.Values(field.name)
+	default:
+		return req.PostForm[field.name]
+	}
+}
+
+// Sets the values, returning why they are invalid if so.
+func (field *bindField) set(value reflect.Value, values []string) string {
+	if isTextType(value.Type()) {
+		// Like net.IP, a slice itself
+		return field.setOne(value, values[0])
+	}
+	switch value.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(value.Type(), len(values), len(values))
+		for i, s := range values {
+			if message := field.setOne(slice.Index(i), s); message != "" {
+				return message
+			}
+		}
+		value.Set(slice)
+		return ""
+	case reflect.Ptr:
+		elem := reflect.New(value.Type().Elem())
+		if message := field.setOne(elem.Elem(), values[0]); message != "" {
+			return message
+		}
+		value.Set(elem)
+		return ""
+	}
+	return field.setOne(value, values[0])
+}
+
+func (field *bindField) setOne(value reflect.Value, s string) string {
+	switch {
+	case value.Type() == timeType:
+		t, err := time.Parse(field.layout, s)
+		if err != nil {
+			return "must be a time like " + field.layout
+		}
+		value.Set(reflect.ValueOf(t))
+		return ""
+	case value.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return "must be a duration like 1h30m"
+		}
+		value.SetInt(int64(d))
+		return ""
+	case isTextType(value.Type()):
+		if err := value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return "is invalid"
+		}
+		return ""
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return "must be true or false"
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, value.Type().Bits())
+		if err != nil {
+			return numberMessage(err, "a whole number")
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, value.Type().Bits())
+		if err != nil {
+			return numberMessage(err, "a positive whole number")
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, value.Type().Bits())
+		if err != nil {
+			return numberMessage(err, "a number")
+		}
+		value.SetFloat(n)
+	}
+	return ""
+}
+
+func numberMessage(err error, kind string) string {
+	if errors.Is(err, strconv.ErrRange) {
+		return "is out of range"
+	}
+	return "must be " + kind
+}
+
+// Checks the rules against the value, returning the first one broken.
+func (field *bindField) validate(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	if field.min != nil || field.max != nil {
+		size := sizeOf(value)
+		if field.min != nil && size < *field.min {
+			return sizeMessage(value, "least", *field.min)
+		}
+		if field.max != nil && size > *field.max {
+			return sizeMessage(value, "most", *field.max)
+		}
+	}
+
+	if field.oneOf == nil && field.regex == nil {
+		return ""
+	}
+	each := []reflect.Value{value}
+	if value.Kind() == reflect.Slice && !isTextType(value.Type()) {
+		each = each[:0]
+		for i := 0; i < value.Len(); i++ {
+			each = append(each, value.Index(i))
+		}
+	}
+	for _, elem := range each {
+		s := fmt.Sprint(elem.Interface())
+		if field.oneOf != nil && !containsString(field.oneOf, s) {
+			return "must be one of " + strings.Join(field.oneOf, ", ")
+		}
+		if field.regex != nil && !field.regex.MatchString(s) {
+			return "must match " + field.regex.String()
+		}
+	}
+	return ""
+}
+
+// Returns what min and max are compared with: the value of numbers,
+// the length of strings and slices.
+func sizeOf(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String()))
+	case reflect.Slice:
+		return float64(value.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	}
+	return value.Float()
+}
+
+// Like "must be at least 3 characters long".
+func sizeMessage(value reflect.Value, bound string, n float64) string {
+	s := strconv.FormatFloat(n, 'g', -1, 64)
+	switch value.Kind() {
+	case reflect.String:
+		return "must be at " + bound + " " + s + " characters long"
+	case reflect.Slice:
+		return "must hold at " + bound + " " + s + " values"
+	}
+	return "must be at " + bound + " " + s
+}
+
+// Parses the form in the request body, returning the status to
+// respond with when it can't.
+func parseForm(req *http.Request) int {
+	var err error
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		err = req.ParseMultipartForm(32 << 20)
+	} else {
+		err = req.ParseForm()
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrBodyTooSlow):
+		return http.StatusRequestTimeout
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,162 @@
+package router
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type listUsers struct {
+	Team     string         `path:"teamid" validate:"required,min=2"`
+	Tenant   string         `header:"X-Tenant" validate:"required"`
+	ClientIP net.IP         `header:"X-Client-IP"`
+	Page     int            `query:"page" validate:"min=1,max=100"`
+	Limit    *uint8         `query:"limit"`
+	Sort     string         `query:"sort" validate:"oneof=name age"`
+	Tags     []string       `query:"tag" validate:"max=2,regex=^[a-z]{1,3}$"`
+	Since    time.Time      `query:"since" layout:"2006-01-02"`
+	Timeout  time.Duration  `query:"timeout"`
+	Active   bool           `query:"active"`
+	Ratio    float64        `query:"ratio"`
+	Note     string         `form:"note" validate:"max=5"`
+	Ignored  string         // Not bound
+	Values   map[string]int // Not bound either
+}
+
+func TestBind(t *testing.T) {
+	var bound listUsers
+	aRouter := NewRouter()
+	aRouter.Post("/team/:teamid/users", func(res http.ResponseWriter, req *http.Request) {
+		bound = listUsers{Page: 1, Ignored: "kept"}
+		if !Context(req).Bind(res, req, &bound) {
+			return
+		}
+		res.Write([]byte("ok"))
+	})
+
+	type testPair struct {
+		path     string
+		tenant   string
+		form     string
+		code     int
+		response string
+	}
+
+	testPairs := []testPair{
+		{"/team/ab/users", "acme", "", http.StatusOK, "ok"},
+		{"/team/ab/users?page=3&limit=20&sort=age&tag=a&tag=bc&since=2015-06-01&timeout=1m30s&active=true&ratio=0.5", "acme", "note=hi", http.StatusOK, "ok"},
+		{"/team/a/users", "", "", http.StatusBadRequest, "path \"teamid\" must be at least 2 characters long\nheader \"X-Tenant\" is required\n"},
+		{"/team/ab/users?page=0", "acme", "", http.StatusBadRequest, "query \"page\" must be at least 1\n"},
+		{"/team/ab/users?page=101", "acme", "", http.StatusBadRequest, "query \"page\" must be at most 100\n"},
+		{"/team/ab/users?page=two", "acme", "", http.StatusBadRequest, "query \"page\" must be a whole number\n"},
+		{"/team/ab/users?limit=300", "acme", "", http.StatusBadRequest, "query \"limit\" is out of range\n"},
+		{"/team/ab/users?sort=date", "acme", "", http.StatusBadRequest, "query \"sort\" must be one of name, age\n"},
+		{"/team/ab/users?tag=a&tag=b&tag=c", "acme", "", http.StatusBadRequest, "query \"tag\" must hold at most 2 values\n"},
+		{"/team/ab/users?tag=a&tag=B", "acme", "", http.StatusBadRequest, "query \"tag\" must match ^[a-z]{1,3}$\n"},
+		{"/team/ab/users?since=yesterday", "acme", "", http.StatusBadRequest, "query \"since\" must be a time like 2006-01-02\n"},
+		{"/team/ab/users?timeout=long", "acme", "", http.StatusBadRequest, "query \"timeout\" must be a duration like 1h30m\n"},
+		{"/team/ab/users?active=maybe", "acme", "", http.StatusBadRequest, "query \"active\" must be true or false\n"},
+		{"/team/ab/users?ratio=half", "acme", "", http.StatusBadRequest, "query \"ratio\" must be a number\n"},
+		{"/team/ab/users", "acme", "note=too+long", http.StatusBadRequest, "form \"note\" must be at most 5 characters long\n"},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("POST", test.path, strings.NewReader(test.form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.tenant != "" {
+			req.Header.Set("X-Tenant", test.tenant)
+		}
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.code || res.Body.String() != test.response {
+			t.Error("Expected ", test.code, " ", test.response, " got ", res.Code, " ", res.Body.String(), " for ", test.path)
+		}
+	}
+
+	// The values of the second request
+	req, _ := http.NewRequest("POST", testPairs[1].path, strings.NewReader(testPairs[1].form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("X-Client-IP", "10.0.0.1")
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	since, _ := time.Parse("2006-01-02", "2015-06-01")
+	if bound.Team != "ab" || bound.Tenant != "acme" || bound.ClientIP.String() != "10.0.0.1" ||
+		bound.Page != 3 || bound.Limit == nil || *bound.Limit != 20 || bound.Sort != "age" ||
+		len(bound.Tags) != 2 || bound.Tags[1] != "bc" || !bound.Since.Equal(since) ||
+		bound.Timeout != 90*time.Second || !bound.Active || bound.Ratio != 0.5 || bound.Note != "hi" {
+		t.Error("Expected the values to be bound got ", bound)
+	}
+	if bound.Ignored != "kept" {
+		t.Error("Expected fields without a tag to be left alone got ", bound.Ignored)
+	}
+}
+
+func TestBindFieldErrors(t *testing.T) {
+	type search struct {
+		Query string `query:"q" validate:"required"`
+		Page  int    `query:"page"`
+	}
+
+	aRouter := NewRouter()
+	aRouter.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err string, code int) {
+		res.WriteHeader(code)
+		json.NewEncoder(res).Encode(Context(req).FieldErrors())
+	}
+	aRouter.Get("/search", func(res http.ResponseWriter, req *http.Request) {
+		var params search
+		Context(req).Bind(res, req, &params)
+	})
+
+	req, _ := http.NewRequest("GET", "/search?page=last", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	expected := `[{"source":"query","name":"q","message":"is required"},{"source":"query","name":"page","message":"must be a whole number"}]` + "\n"
+	if res.Code != http.StatusBadRequest || res.Body.String() != expected {
+		t.Error("Expected the field errors as JSON got ", res.Code, " ", res.Body.String())
+	}
+}
+
+func TestBindInvalidTags(t *testing.T) {
+	type testPair struct {
+		name string
+		v    interface{}
+	}
+
+	testPairs := []testPair{
+		{"not a pointer", struct{}{}},
+		{"unsupported type", &struct {
+			Values map[string]int `query:"values"`
+		}{}},
+		{"unknown rule", &struct {
+			Page int `query:"page" validate:"positive"`
+		}{}},
+		{"min on a bool", &struct {
+			Active bool `query:"active" validate:"min=1"`
+		}{}},
+		{"invalid regex", &struct {
+			Name string `query:"name" validate:"regex=["`
+		}{}},
+	}
+
+	for _, test := range testPairs {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected a panic for ", test.name)
+				}
+			}()
+			req, _ := http.NewRequest("GET", "/?"+url.Values{}.Encode(), nil)
+			cntxt := new(RequestContext)
+			cntxt.errorHandler = defaultErrorHandler
+			cntxt.Bind(httptest.NewRecorder(), req, test.v)
+		}()
+	}
+}
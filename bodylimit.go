@@ -0,0 +1,181 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Body limits
+// --------------------------------
+
+// ErrBodyTooSlow is returned when reading a request body sent slower than
+// the MinReadRate of the BodyLimit handler.
+var ErrBodyTooSlow = errors.New("router: request body sent too slowly")
+
+// Bytes a client is allowed to be behind on the minimum read rate.
+const minReadChunk = 4096
+
+// BodyLimitOptions configures the BodyLimit handler.
+type BodyLimitOptions struct {
+	MaxBytes        int64         // Maximum size of the body, the router's MaxBodyBytes when 0
+	MinReadRate     int64         // Minimum number of bytes per second clients have to send, not enforced when 0
+	ReadGracePeriod time.Duration // Time before MinReadRate is enforced, defaults to 5 seconds
+}
+
+// BodyLimit returns a HandlerFunc limiting the request body. Register it on
+// a route to change the router's MaxBodyBytes for that route, or mount it.
+//
+//	appRouter.MaxBodyBytes = 1 << 20
+//	appRouter.Post("/upload", router.BodyLimit(router.BodyLimitOptions{
+//		MaxBytes:    1 << 30,
+//		MinReadRate: 10 << 10,
+//	}), upload)
+//
+// Reading a body larger than allowed fails with an *http.MaxBytesError,
+// reading one sent slower than MinReadRate with ErrBodyTooSlow. When the
+// handlers don't respond themselves, the ErrorHandler responds with a 413 or
+// 408. Bodies which are declared too large by their Content-Length already
+// fail on the first read.
+//
+// Limits can be changed as long as the body has not been read.
+func BodyLimit(options BodyLimitOptions) http.HandlerFunc {
+	if options.ReadGracePeriod == 0 {
+		options.ReadGracePeriod = 5 * time.Second
+	}
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		if body := cntxt.limitBody(req); body != nil {
+			body.lock.Lock()
+			if options.MaxBytes > 0 {
+				body.limit = options.MaxBytes
+			}
+			body.minRate = options.MinReadRate
+			body.grace = options.ReadGracePeriod
+			body.lock.Unlock()
+		}
+		cntxt.Next(res, req)
+	}
+}
+
+// Replaces the request's body with one enforcing limits, returns nil
+// when the request has no body. Handlers after Timeout run in their own
+// goroutine, so the body is only accessed while holding the lock.
+func (cntxt *RequestContext) limitBody(req *http.Request) *limitedBody {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	if cntxt.body != nil {
+		return cntxt.body
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	cntxt.body = &limitedBody{
+		original:      req.Body,
+		res:           cntxt.writer.ResponseWriter,
+		contentLength: req.ContentLength,
+	}
+	req.Body = cntxt.body
+	return cntxt.body
+}
+
+// Lets the ErrorHandler respond when reading the body failed
+// because of its limits and the handlers did not respond.
+func (cntxt *RequestContext) checkBody(res http.ResponseWriter, req *http.Request) {
+	cntxt.lock.Lock()
+	body := cntxt.body
+	cntxt.lock.Unlock()
+	if body == nil || cntxt.response.Written() {
+		return
+	}
+	body.lock.Lock()
+	exceeded, tooSlow := body.exceeded, body.tooSlow
+	body.lock.Unlock()
+
+	if exceeded {
+		cntxt.Error(res, req, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	} else if tooSlow {
+		cntxt.Error(res, req, http.StatusText(http.StatusRequestTimeout), http.StatusRequestTimeout)
+	}
+}
+
+// Request body enforcing a maximum size, using http.MaxBytesReader, and
+// a minimum read rate, using read deadlines when the server supports them.
+type limitedBody struct {
+	lock          sync.Mutex
+	original      io.ReadCloser
+	reader        io.Reader
+	res           http.ResponseWriter // Unwrapped, for http.MaxBytesReader to close the connection
+	contentLength int64
+	limit         int64
+	minRate       int64
+	grace         time.Duration
+	start         time.Time
+	read          int64
+	exceeded      bool
+	tooSlow       bool
+}
+
+func (body *limitedBody) Read(p []byte) (n int, err error) {
+	body.lock.Lock()
+	if body.reader == nil {
+		body.start = time.Now()
+		body.reader = body.original
+		if body.limit > 0 {
+			if body.contentLength > body.limit {
+				body.exceeded = true
+				body.lock.Unlock()
+				return 0, &http.MaxBytesError{Limit: body.limit}
+			}
+			body.reader = http.MaxBytesReader(body.res, body.original, body.limit)
+		}
+	}
+	reader, minRate := body.reader, body.minRate
+	if minRate > 0 {
+		allowed := time.Duration(float64(body.read+minReadChunk) / float64(minRate) * float64(time.Second))
+		http.NewResponseController(body.res).SetReadDeadline(body.start.Add(body.grace + allowed))
+	}
+	body.lock.Unlock()
+
+	n, err = reader.Read(p)
+
+	body.lock.Lock()
+	defer body.lock.Unlock()
+	body.read += int64(n)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		body.exceeded = true
+	}
+	if minRate > 0 {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			body.tooSlow = true
+			return n, ErrBodyTooSlow
+		}
+		if err == io.EOF {
+			http.NewResponseController(body.res).SetReadDeadline(time.Time{})
+		} else if body.isTooSlow(time.Now()) {
+			// For servers not supporting read deadlines
+			body.tooSlow = true
+			return n, ErrBodyTooSlow
+		}
+	}
+	return n, err
+}
+
+// Reports whether the client is sending slower than the minimum rate.
+func (body *limitedBody) isTooSlow(now time.Time) bool {
+	elapsed := now.Sub(body.start) - body.grace
+	if elapsed <= 0 {
+		return false
+	}
+	return float64(body.read+minReadChunk) < float64(body.minRate)*elapsed.Seconds()
+}
+
+func (body *limitedBody) Close() error {
+	return body.original.Close()
+}
@@ -0,0 +1,156 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyLimit(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.MaxBodyBytes = 10
+
+	read := func(res http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return
+		}
+		res.Write(body)
+	}
+	aRouter.Post("/", read)
+	aRouter.Post("/upload", BodyLimit(BodyLimitOptions{MaxBytes: 100}), read)
+	aRouter.Post("/custom", func(res http.ResponseWriter, req *http.Request) {
+		var maxBytesErr *http.MaxBytesError
+		if _, err := ioutil.ReadAll(req.Body); errors.As(err, &maxBytesErr) {
+			http.Error(res, "too much", http.StatusBadRequest)
+		}
+	})
+
+	type testPair struct {
+		path          string
+		body          string
+		contentLength bool
+		expected      int
+	}
+
+	testPairs := []testPair{
+		{"/", "small", true, http.StatusOK},
+		{"/", strings.Repeat("a", 20), true, http.StatusRequestEntityTooLarge},
+		{"/", strings.Repeat("a", 20), false, http.StatusRequestEntityTooLarge},
+		{"/upload", strings.Repeat("a", 20), true, http.StatusOK},
+		{"/upload", strings.Repeat("a", 200), false, http.StatusRequestEntityTooLarge},
+		{"/custom", strings.Repeat("a", 20), true, http.StatusBadRequest},
+	}
+
+	for _, test := range testPairs {
+		// Hide the length of the body from NewRequest for chunked bodies
+		var body io.Reader = strings.NewReader(test.body)
+		if !test.contentLength {
+			body = ioutil.NopCloser(body)
+		}
+		req, _ := http.NewRequest("POST", test.path, body)
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.expected {
+			t.Error("Expected ", test.expected, " got ", res.Code, " for ", test.path, " with ", len(test.body), " bytes")
+		}
+		if test.expected == http.StatusOK && res.Body.String() != test.body {
+			t.Error("Expected the body to be read got ", res.Body.String())
+		}
+	}
+}
+
+func TestBodyLimitContentLength(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.MaxBodyBytes = 10
+
+	body := &countingReader{Reader: strings.NewReader(strings.Repeat("a", 20))}
+	aRouter.Post("/", func(res http.ResponseWriter, req *http.Request) {
+		if _, err := req.Body.Read(make([]byte, 5)); err == nil {
+			t.Error("Expected the first read to fail")
+		}
+	})
+
+	req, _ := http.NewRequest("POST", "/", body)
+	req.ContentLength = 20
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusRequestEntityTooLarge || body.read != 0 {
+		t.Error("Expected a 413 without reading the body got ", res.Code, body.read)
+	}
+}
+
+func TestBodyLimitMinReadRate(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Post("/", BodyLimit(BodyLimitOptions{
+		MinReadRate:     40 << 10,
+		ReadGracePeriod: 50 * time.Millisecond,
+	}), func(res http.ResponseWriter, req *http.Request) {
+		if _, err := ioutil.ReadAll(req.Body); err != ErrBodyTooSlow {
+			t.Error("Expected the read to fail got ", err)
+		}
+	})
+
+	server := httptest.NewServer(aRouter)
+	defer server.Close()
+
+	// Send a bit, then stall
+	body, writer := io.Pipe()
+	defer writer.Close()
+	go writer.Write([]byte("hello"))
+
+	res, err := http.Post(server.URL, "text/plain", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusRequestTimeout {
+		t.Error("Expected a 408 got ", res.StatusCode)
+	}
+}
+
+func TestLimitedBodyIsTooSlow(t *testing.T) {
+	start := time.Now()
+	body := &limitedBody{start: start, minRate: 1000, grace: time.Second}
+
+	type testPair struct {
+		read     int64
+		elapsed  time.Duration
+		expected bool
+	}
+
+	testPairs := []testPair{
+		{0, 500 * time.Millisecond, false},
+		{0, 5 * time.Second, false},
+		{0, 6 * time.Second, true},
+		{10000, 10 * time.Second, false},
+		{10000, 16 * time.Second, true},
+	}
+
+	for _, test := range testPairs {
+		body.read = test.read
+		if tooSlow := body.isTooSlow(start.Add(test.elapsed)); tooSlow != test.expected {
+			t.Error("Expected ", test.expected, " for ", test.read, " bytes in ", test.elapsed)
+		}
+	}
+}
+
+// Counts the bytes read from it
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	reader.read += n
+	return n, err
+}
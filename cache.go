@@ -0,0 +1,402 @@
+package router
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response cache
+// --------------------------------
+
+// ResponseCache caches responses of routes in memory, evicting the least
+// recently used ones when full. Create one with NewResponseCache and
+// register its Handler on the routes to cache.
+type ResponseCache struct {
+	maxBytes int
+	lock     sync.Mutex
+	size     int
+	lru      *list.List               // Of *cacheEntry, most recently used first
+	entries  map[string]*list.Element // By key
+	names    map[string]map[string]*list.Element
+	calls    map[string]*cacheCall // Handler chains in progress, by key
+	now      func() time.Time
+}
+
+// A cached response.
+type cacheEntry struct {
+	key    string
+	name   string
+	params Params
+	status int
+	header http.Header
+	body   []byte
+	stored time.Time
+	ttl    time.Duration
+	stale  time.Duration
+}
+
+// A handler chain producing the response for a key, waited on by
+// concurrent requests for the same key.
+type cacheCall struct {
+	done  chan struct{}
+	entry *cacheEntry // Nil when the response could not be cached
+}
+
+// NewResponseCache creates a cache holding responses up to
+// maxBytes in total.
+func NewResponseCache(maxBytes int) *ResponseCache {
+	return &ResponseCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		names:    make(map[string]map[string]*list.Element),
+		calls:    make(map[string]*cacheCall),
+		now:      time.Now,
+	}
+}
+
+// ResponseCacheOptions configures caching for a route.
+type ResponseCacheOptions struct {
+	Name                 string        // Name to invalidate the route's responses by
+	TTL                  time.Duration // How long responses are fresh
+	StaleWhileRevalidate time.Duration // How long after that stale responses are served while refreshing them
+	QueryParams          []string      // Query params the response depends on, others are ignored
+	Vary                 []string      // Request headers the response depends on
+}
+
+// Handler returns a HandlerFunc caching the responses of the route it's
+// registered on.
+//
+//	cache := router.NewResponseCache(64 << 20)
+//	appRouter.Get("/report/:year", cache.Handler(router.ResponseCacheOptions{
+//		Name:                 "report",
+//		TTL:                  time.Minute,
+//		StaleWhileRevalidate: 10 * time.Minute,
+//		QueryParams:          []string{"format"},
+//	}), buildReport)
+//
+// Responses are cached by method, route, params, the listed query params
+// and request headers. Only GET and HEAD requests with a 200 response are
+// cached, unless the response sets a cookie, is marked no-store or
+// private, or varies on other request headers.
+//
+// Concurrent requests for a response which is not cached wait for the
+// first one, instead of running the handlers too. Within the
+// StaleWhileRevalidate period stale responses are served right away while
+// the handlers run in the background to refresh them.
+func (cache *ResponseCache) Handler(options ResponseCacheOptions) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		if req.Method != "GET" && req.Method != "HEAD" {
+			cntxt.Next(res, req)
+			return
+		}
+
+		key := cacheKey(req, cntxt, &options)
+		now := cache.now()
+
+		cache.lock.Lock()
+		entry := cache.lookup(key)
+		if entry != nil {
+			age := now.Sub(entry.stored)
+			if age < entry.ttl {
+				cache.lock.Unlock()
+				entry.writeTo(res, age)
+				return
+			}
+			if age < entry.ttl+entry.stale {
+				if _, refreshing := cache.calls[key]; !refreshing {
+					cache.revalidate(key, cntxt, req, res.Header().Clone(), &options)
+				}
+				cache.lock.Unlock()
+				entry.writeTo(res, age)
+				return
+			}
+		}
+
+		// Wait for the response when another request is producing it
+		if call, ok := cache.calls[key]; ok {
+			cache.lock.Unlock()
+			select {
+			case <-call.done:
+				if call.entry != nil {
+					call.entry.writeTo(res, 0)
+					return
+				}
+			case <-req.Context().Done():
+				return
+			}
+			cntxt.Next(res, req)
+			return
+		}
+		call := &cacheCall{done: make(chan struct{})}
+		cache.calls[key] = call
+		cache.lock.Unlock()
+
+		recorder := &cacheRecorder{ResponseWriter: res, before: res.Header().Clone()}
+		defer cache.finish(key, call, recorder, cntxt, &options)
+		cntxt.Next(recorder, req)
+		recorder.completed = true
+	}
+}
+
+// Invalidate removes the responses cached for the routes with the given
+// name. When params are given, only the responses for those are removed.
+//
+//	cache.Invalidate("report", router.Params{{Name: "year", Value: "2015"}})
+func (cache *ResponseCache) Invalidate(name string, params Params) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for _, elem := range cache.names[name] {
+		entry := elem.Value.(*cacheEntry)
+		matches := true
+		for _, param := range params {
+			if value, ok := entry.params.Lookup(param.Name); !ok || value != param.Value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			cache.remove(elem)
+		}
+	}
+}
+
+// Runs the remaining handlers in the background to refresh a stale
+// response, starting from the headers set before the cache handler.
+// Expects the lock to be held.
+func (cache *ResponseCache) revalidate(key string, cntxt *RequestContext, req *http.Request, header http.Header, options *ResponseCacheOptions) {
+	call := &cacheCall{done: make(chan struct{})}
+	cache.calls[key] = call
+
+	// Outlive the request, like Timeout
+	bgReq := req.WithContext(context.WithoutCancel(req.Context()))
+	cntxt.hold()
+	go func() {
+		recorder := &cacheRecorder{ResponseWriter: &discardWriter{header: header.Clone()}, before: header}
+		defer func() {
+			if cntxt.unhold() {
+				releaseContext(cntxt)
+			}
+		}()
+		defer cache.finish(key, call, recorder, cntxt, options)
+		cntxt.nextWithRequest(recorder, bgReq)
+		recorder.completed = true
+	}()
+}
+
+// Stores the recorded response, when it can be cached, and
+// wakes up the requests waiting for it.
+func (cache *ResponseCache) finish(key string, call *cacheCall, recorder *cacheRecorder, cntxt *RequestContext, options *ResponseCacheOptions) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if recorder.isCacheable(options) {
+		entry := &cacheEntry{
+			key:    key,
+			name:   options.Name,
+			params: append(Params(nil), cntxt.params...),
+			status: recorder.status,
+			header: recorder.header,
+			body:   recorder.body.Bytes(),
+			stored: cache.now(),
+			ttl:    options.TTL,
+			stale:  options.StaleWhileRevalidate,
+		}
+		if entry.size() <= cache.maxBytes {
+			cache.store(entry)
+			call.entry = entry
+		}
+	}
+	delete(cache.calls, key)
+	close(call.done)
+}
+
+// Returns the entry for the key, marking it as recently used.
+// Expects the lock to be held.
+func (cache *ResponseCache) lookup(key string) *cacheEntry {
+	elem, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+	cache.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry)
+}
+
+// Adds the entry, evicting the least recently used ones to make room.
+// Expects the lock to be held.
+func (cache *ResponseCache) store(entry *cacheEntry) {
+	if elem, ok := cache.entries[entry.key]; ok {
+		cache.remove(elem)
+	}
+	for cache.size+entry.size() > cache.maxBytes && cache.lru.Len() > 0 {
+		cache.remove(cache.lru.Back())
+	}
+
+	elem := cache.lru.PushFront(entry)
+	cache.entries[entry.key] = elem
+	if cache.names[entry.name] == nil {
+		cache.names[entry.name] = make(map[string]*list.Element)
+	}
+	cache.names[entry.name][entry.key] = elem
+	cache.size += entry.size()
+}
+
+// Expects the lock to be held.
+func (cache *ResponseCache) remove(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	cache.lru.Remove(elem)
+	delete(cache.entries, entry.key)
+	delete(cache.names[entry.name], entry.key)
+	if len(cache.names[entry.name]) == 0 {
+		delete(cache.names, entry.name)
+	}
+	cache.size -= entry.size()
+}
+
+// Approximates the memory used by the entry.
+func (entry *cacheEntry) size() int {
+	size := len(entry.key) + len(entry.body)
+	for key, values := range entry.header {
+		size += len(key)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return size
+}
+
+// Sends the cached response. Only the headers set by the handlers after
+// the cache, and the Content-Security-Policy the body was rendered for,
+// are replayed. Other headers set before it are the current request's.
+func (entry *cacheEntry) writeTo(res http.ResponseWriter, age time.Duration) {
+	header := res.Header()
+	for key, values := range entry.header {
+		header[key] = values
+	}
+	header.Set("Age", strconv.Itoa(int(age/time.Second)))
+	res.WriteHeader(entry.status)
+	res.Write(entry.body)
+}
+
+// Builds the key identifying the response to the request.
+func cacheKey(req *http.Request, cntxt *RequestContext, options *ResponseCacheOptions) string {
+	var key strings.Builder
+	key.WriteString(req.Method)
+	key.WriteByte(' ')
+	key.WriteString(cntxt.Route())
+	for _, param := range cntxt.params {
+		key.WriteString(" :" + param.Name + "=" + strconv.Quote(param.Value))
+	}
+	if len(options.QueryParams) > 0 {
+		query := req.URL.Query()
+		for _, name := range options.QueryParams {
+			key.WriteString(" ?" + name + "=" + strconv.Quote(strings.Join(query[name], ",")))
+		}
+	}
+	for _, name := range options.Vary {
+		key.WriteString(" " + http.CanonicalHeaderKey(name) + "=" + strconv.Quote(req.Header.Get(name)))
+	}
+	return key.String()
+}
+
+// cacheRecorder passes the response on while recording it.
+type cacheRecorder struct {
+	http.ResponseWriter
+	before      http.Header // Headers set before the cache, like a request ID, which aren't cached
+	header      http.Header // Headers the handlers after the cache added or changed
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+	completed   bool // The handlers returned without panicking
+}
+
+func (recorder *cacheRecorder) WriteHeader(code int) {
+	if !recorder.wroteHeader && (code < 100 || code > 199) {
+		recorder.wroteHeader = true
+		recorder.status = code
+		recorder.header = changedHeaders(recorder.before, recorder.Header())
+		// The body can hold the nonce of the policy, they're replayed together
+		for _, name := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"} {
+			if values := recorder.Header().Values(name); len(values) > 0 {
+				recorder.header[name] = slices.Clone(values)
+			}
+		}
+	}
+	recorder.ResponseWriter.WriteHeader(code)
+}
+
+func (recorder *cacheRecorder) Write(data []byte) (int, error) {
+	if !recorder.wroteHeader {
+		recorder.WriteHeader(http.StatusOK)
+	}
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+// Reports whether the recorded response can be cached. Responses can only
+// vary by headers set before the cache, which don't affect it, or by the
+// request headers which are part of the key.
+func (recorder *cacheRecorder) isCacheable(options *ResponseCacheOptions) bool {
+	if !recorder.completed || recorder.status != http.StatusOK {
+		return false
+	}
+	header := recorder.header
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == "no-store" || directive == "private" {
+			return false
+		}
+	}
+	allowed := append(splitHeaderValues(recorder.before.Values("Vary")), options.Vary...)
+	for _, vary := range splitHeaderValues(header.Values("Vary")) {
+		if !slices.ContainsFunc(allowed, func(name string) bool { return strings.EqualFold(name, vary) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits header values holding comma separated lists, like Vary.
+func splitHeaderValues(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// Returns the headers which are new or have other values than before.
+func changedHeaders(before, after http.Header) http.Header {
+	changed := make(http.Header)
+	for key, values := range after {
+		if !slices.Equal(before[key], values) {
+			changed[key] = slices.Clone(values)
+		}
+	}
+	return changed
+}
+
+// discardWriter throws away responses refreshed in the background.
+type discardWriter struct {
+	header http.Header
+}
+
+func (dw *discardWriter) Header() http.Header            { return dw.header }
+func (dw *discardWriter) Write(data []byte) (int, error) { return len(data), nil }
+func (dw *discardWriter) WriteHeader(code int)           {}
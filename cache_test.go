@@ -0,0 +1,299 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	cache := NewResponseCache(1 << 20)
+	var calls int32
+
+	aRouter := NewRouter()
+	aRouter.Get("/report/:year", cache.Handler(ResponseCacheOptions{
+		Name:        "report",
+		TTL:         time.Minute,
+		QueryParams: []string{"format"},
+		Vary:        []string{"Accept-Language"},
+	}), func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		cntxt := Context(req)
+		res.Header().Set("Content-Type", "text/plain")
+		// Already part of the key, so it can still be cached
+		res.Header().Set("Vary", "accept-language")
+		res.Write([]byte(cntxt.Params["year"] + " " + req.URL.Query().Get("format") + " " + req.Header.Get("Accept-Language")))
+	})
+
+	type testPair struct {
+		url      string
+		language string
+		body     string
+		calls    int32
+	}
+
+	testPairs := []testPair{
+		{"/report/2015", "", "2015  ", 1},
+		{"/report/2015", "", "2015  ", 1},
+		{"/report/2015?utm_source=mail", "", "2015  ", 1},
+		{"/report/2015?format=csv", "", "2015 csv ", 2},
+		{"/report/2015?format=csv", "", "2015 csv ", 2},
+		{"/report/2014", "", "2014  ", 3},
+		{"/report/2015", "nl", "2015  nl", 4},
+		{"/report/2015", "nl", "2015  nl", 4},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", test.url, nil)
+		if test.language != "" {
+			req.Header.Set("Accept-Language", test.language)
+		}
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Body.String() != test.body || res.Header().Get("Content-Type") != "text/plain" {
+			t.Error("Expected ", test.body, " got ", res.Body.String(), " for ", test.url)
+		}
+		if atomic.LoadInt32(&calls) != test.calls {
+			t.Error("Expected ", test.calls, " calls got ", calls, " for ", test.url)
+		}
+	}
+
+	// Invalidate a single year
+	cache.Invalidate("report", Params{{Name: "year", Value: "2015"}})
+	for _, url := range []string{"/report/2015", "/report/2014"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		aRouter.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 5 {
+		t.Error("Expected only 2015 to be invalidated got ", calls, " calls")
+	}
+
+	// Invalidate all
+	cache.Invalidate("report", nil)
+	req, _ := http.NewRequest("GET", "/report/2014", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+	if calls != 6 {
+		t.Error("Expected all reports to be invalidated got ", calls, " calls")
+	}
+}
+
+func TestResponseCacheNotCacheable(t *testing.T) {
+	cache := NewResponseCache(1 << 20)
+	var calls int32
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", Compress(CompressOptions{}))
+	handler := cache.Handler(ResponseCacheOptions{TTL: time.Minute})
+	count := func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		Context(req).Next(res, req)
+	}
+	aRouter.Get("/missing", handler, count, func(res http.ResponseWriter, req *http.Request) {
+		http.NotFound(res, req)
+	})
+	aRouter.Get("/cookie", handler, count, func(res http.ResponseWriter, req *http.Request) {
+		http.SetCookie(res, &http.Cookie{Name: "session", Value: "abc"})
+	})
+	aRouter.Get("/private", handler, count, CacheControl("private"), func(res http.ResponseWriter, req *http.Request) {})
+	aRouter.Get("/vary", handler, count, func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Add("Vary", "Cookie")
+	})
+	aRouter.Get("/compressed", handler, count, func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(strings.Repeat("a", 2000)))
+	})
+
+	for _, path := range []string{"/missing", "/cookie", "/private", "/vary"} {
+		calls = 0
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest("GET", path, nil)
+			aRouter.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		if calls != 2 {
+			t.Error("Expected ", path, " not to be cached")
+		}
+	}
+
+	// Vary set before the cache does not matter
+	calls = 0
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/compressed", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+		if res.Header().Get("Content-Encoding") != "gzip" {
+			t.Error("Expected the cached response to be compressed got ", res.Header())
+		}
+	}
+	if calls != 1 {
+		t.Error("Expected the response to be cached got ", calls, " calls")
+	}
+}
+
+func TestResponseCachePerRequestHeaders(t *testing.T) {
+	cache := NewResponseCache(1 << 20)
+	var calls int32
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", RequestID(RequestIDOptions{}))
+	aRouter.Mount("/", SecurityHeaders(SecurityHeadersOptions{ContentSecurityPolicy: "script-src 'nonce-{nonce}'"}))
+	aRouter.Get("/page", cache.Handler(ResponseCacheOptions{TTL: time.Minute}), func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		res.Header().Set("Content-Type", "text/plain")
+		res.Write([]byte("page " + Context(req).CSPNonce()))
+	})
+
+	var requestIDs []string
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/page", nil)
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if !strings.HasPrefix(res.Body.String(), "page ") || res.Header().Get("Content-Type") != "text/plain" {
+			t.Error("Expected the page got ", res.Body.String(), " ", res.Header())
+		}
+		// Scripts only run when the nonce rendered matches the policy
+		nonce := strings.TrimPrefix(res.Body.String(), "page ")
+		if policy := res.Header().Get("Content-Security-Policy"); nonce == "" || policy != "script-src 'nonce-"+nonce+"'" {
+			t.Error("Expected the policy to allow nonce ", nonce, " got ", policy)
+		}
+		requestIDs = append(requestIDs, res.Header().Get("X-Request-ID"))
+	}
+
+	if calls != 1 {
+		t.Error("Expected the response to be cached got ", calls, " calls")
+	}
+	if requestIDs[0] == "" || requestIDs[0] == requestIDs[1] {
+		t.Error("Expected every response to have its own request ID got ", requestIDs)
+	}
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	cache := NewResponseCache(1 << 20)
+	var lock sync.Mutex
+	now := time.Now()
+	cache.now = func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		lock.Lock()
+		now = now.Add(d)
+		lock.Unlock()
+	}
+
+	var version int32
+	refreshed := make(chan bool, 1)
+	aRouter := NewRouter()
+	aRouter.Get("/", cache.Handler(ResponseCacheOptions{
+		TTL:                  time.Minute,
+		StaleWhileRevalidate: time.Hour,
+	}), func(res http.ResponseWriter, req *http.Request) {
+		v := atomic.AddInt32(&version, 1)
+		res.Write([]byte{byte('0' + v)})
+		if v > 1 {
+			refreshed <- true
+		}
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+		return res
+	}
+
+	get()
+	advance(2 * time.Minute)
+
+	// Stale, served right away while refreshing
+	if res := get(); res.Body.String() != "1" || res.Header().Get("Age") != "120" {
+		t.Error("Expected the stale response got ", res.Body.String(), res.Header().Get("Age"))
+	}
+	<-refreshed
+	// Wait for the refreshed response to be stored
+	for i := 0; i < 100; i++ {
+		if res := get(); res.Body.String() == "2" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if res := get(); res.Body.String() != "2" {
+		t.Error("Expected the refreshed response got ", res.Body.String())
+	}
+
+	// Too stale, refreshed before responding
+	advance(2 * time.Hour)
+	if res := get(); res.Body.String() != "3" {
+		t.Error("Expected a fresh response got ", res.Body.String())
+	}
+	<-refreshed
+}
+
+func TestResponseCacheCoalescing(t *testing.T) {
+	cache := NewResponseCache(1 << 20)
+	var calls int32
+	proceed := make(chan bool)
+
+	aRouter := NewRouter()
+	aRouter.Get("/", cache.Handler(ResponseCacheOptions{TTL: time.Minute}), func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-proceed
+		res.Write([]byte("expensive"))
+	})
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/", nil)
+			res := httptest.NewRecorder()
+			aRouter.ServeHTTP(res, req)
+			bodies[i] = res.Body.String()
+		}(i)
+	}
+
+	// Give the requests time to queue up
+	time.Sleep(50 * time.Millisecond)
+	close(proceed)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Error("Expected the handler to be called once got ", calls)
+	}
+	for _, body := range bodies {
+		if body != "expensive" {
+			t.Error("Expected all requests to get the response got ", body)
+		}
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache := NewResponseCache(500)
+	aRouter := NewRouter()
+	aRouter.Get("/:id", cache.Handler(ResponseCacheOptions{TTL: time.Minute}), func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(strings.Repeat("a", 100)))
+	})
+
+	for _, id := range []string{"1", "2", "3", "1", "4", "5"} {
+		req, _ := http.NewRequest("GET", "/"+id, nil)
+		aRouter.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if cache.size > 500 {
+		t.Error("Expected the cache to stay within its size got ", cache.size)
+	}
+	if _, ok := cache.entries["GET /:id :id=\"1\""]; !ok {
+		t.Error("Expected the recently used entry to be kept")
+	}
+	if _, ok := cache.entries["GET /:id :id=\"2\""]; ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+}
@@ -0,0 +1,306 @@
+package router
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Compress
+// --------------------------------
+
+// Encoder compresses responses for a content coding like "gzip".
+//
+// Implement it to add content codings like "br" or "zstd".
+type Encoder interface {
+	// Encoding returns the content coding as used in the
+	// Accept-Encoding and Content-Encoding headers.
+	Encoding() string
+	// NewWriter returns a writer compressing everything written to it into w.
+	NewWriter(w io.Writer) EncoderWriter
+}
+
+// EncoderWriter compresses everything written to it. Flush is called for
+// streaming responses and Close once the response is done.
+type EncoderWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// GzipEncoder is the Encoder for the "gzip" content coding.
+// A zero Level uses gzip.DefaultCompression.
+type GzipEncoder struct {
+	Level int
+}
+
+// Encoding returns "gzip".
+func (encoder GzipEncoder) Encoding() string {
+	return "gzip"
+}
+
+// NewWriter returns a gzip.Writer, reused between responses.
+func (encoder GzipEncoder) NewWriter(w io.Writer) EncoderWriter {
+	level := compressionLevel(encoder.Level)
+	if zw, ok := gzipWriterPools[level].Get().(*gzip.Writer); ok {
+		zw.Reset(w)
+		return &pooledEncoderWriter{zw, &gzipWriterPools[level]}
+	}
+	zw, err := gzip.NewWriterLevel(w, level-2)
+	if err != nil {
+		zw = gzip.NewWriter(w)
+	}
+	return &pooledEncoderWriter{zw, &gzipWriterPools[level]}
+}
+
+// DeflateEncoder is the Encoder for the "deflate" content coding.
+// A zero Level uses flate.DefaultCompression.
+type DeflateEncoder struct {
+	Level int
+}
+
+// Encoding returns "deflate".
+func (encoder DeflateEncoder) Encoding() string {
+	return "deflate"
+}
+
+// NewWriter returns a flate.Writer, reused between responses.
+func (encoder DeflateEncoder) NewWriter(w io.Writer) EncoderWriter {
+	level := compressionLevel(encoder.Level)
+	if fw, ok := flateWriterPools[level].Get().(*flate.Writer); ok {
+		fw.Reset(w)
+		return &pooledEncoderWriter{fw, &flateWriterPools[level]}
+	}
+	fw, err := flate.NewWriter(w, level-2)
+	if err != nil {
+		fw, _ = flate.NewWriter(w, flate.DefaultCompression)
+	}
+	return &pooledEncoderWriter{fw, &flateWriterPools[level]}
+}
+
+// Pools of gzip and flate writers, one for each compression level
+// from HuffmanOnly (-2) to BestCompression (9).
+var gzipWriterPools, flateWriterPools [12]sync.Pool
+
+// Returns the index in the writer pools for the given compression level.
+func compressionLevel(level int) int {
+	if level == 0 || level < flate.HuffmanOnly || level > flate.BestCompression {
+		level = flate.DefaultCompression
+	}
+	return level + 2
+}
+
+// Puts the writer back in its pool once it is closed.
+type pooledEncoderWriter struct {
+	EncoderWriter
+	pool *sync.Pool
+}
+
+func (pw *pooledEncoderWriter) Close() error {
+	err := pw.EncoderWriter.Close()
+	pw.pool.Put(pw.EncoderWriter)
+	return err
+}
+
+// CompressOptions configures the Compress handler.
+type CompressOptions struct {
+	Encoders         []Encoder // Encoders in order of preference, defaults to gzip followed by deflate
+	MinSize          int       // Responses smaller than this are sent uncompressed, defaults to 1024 bytes
+	SkipContentTypes []string  // Content types not to compress, defaults to DefaultSkipContentTypes
+}
+
+// DefaultSkipContentTypes lists content types which are already
+// compressed. Entries ending in "/" match a whole group.
+var DefaultSkipContentTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/",
+	"font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed",
+}
+
+// Compress returns a HandlerFunc compressing the responses of the handlers
+// after it, using the content coding the client prefers.
+//
+//	appRouter.Mount("/", router.Compress(router.CompressOptions{}))
+//
+// Responses are buffered until MinSize bytes are written, to skip small
+// ones. Calling Flush sends whatever is buffered compressed, so streaming
+// responses keep working. Responses with a Content-Encoding already set or
+// a content type in SkipContentTypes are passed on as they are, and so are
+// requests to upgrade the connection, like WebSocket handshakes.
+//
+// The compressed bytes are written to the router's ResponseWriter, so
+// `cntxt.Response().Size()` reports the compressed size. They differ from
+// the ones an ETag was computed for, so ETags are weakened. That is done
+// for all responses to clients accepting an encoding, compressed or not,
+// so a 304 carries the same ETag as the response it stands for.
+func Compress(options CompressOptions) http.HandlerFunc {
+	if len(options.Encoders) == 0 {
+		options.Encoders = []Encoder{GzipEncoder{}, DeflateEncoder{}}
+	}
+	if options.MinSize == 0 {
+		options.MinSize = 1024
+	}
+	if options.SkipContentTypes == nil {
+		options.SkipContentTypes = DefaultSkipContentTypes
+	}
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Add("Vary", "Accept-Encoding")
+
+		encoder := negotiateEncoder(options.Encoders, req.Header.Get("Accept-Encoding"))
+		if encoder == nil || req.Method == "HEAD" || req.Header.Get("Upgrade") != "" {
+			Context(req).Next(res, req)
+			return
+		}
+
+		cw := &compressWriter{encoder: encoder, options: &options}
+		// Hold on to the response until we know whether to compress it
+		cw.bufferedWriter = bufferedWriter{ResponseWriter: res, committer: cw, limit: options.MinSize - 1, weakETag: true}
+		defer cw.close()
+		Context(req).Next(cw, req)
+	}
+}
+
+// Picks the encoder the client prefers according to the Accept-Encoding
+// header. When the client likes several equally, the one listed first
+// in encoders wins.
+func negotiateEncoder(encoders []Encoder, acceptEncoding string) Encoder {
+	if acceptEncoding == "" {
+		return nil
+	}
+	accepted := parseQualityValues(acceptEncoding)
+
+	var best Encoder
+	bestQuality := 0.0
+	for _, encoder := range encoders {
+		quality, ok := qualityOf(accepted, encoder.Encoding())
+		if !ok {
+			quality, _ = qualityOf(accepted, "*")
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoder, quality
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the response once it knows it is big enough
+// and of a content type worth compressing.
+type compressWriter struct {
+	bufferedWriter
+	encoder Encoder
+	options *CompressOptions
+	writer  EncoderWriter // Set once compressing
+}
+
+// Decides whether to compress, sends the headers and whatever has been
+// buffered. Streaming responses are compressed regardless of their size.
+func (cw *compressWriter) commit(streaming bool) error {
+	header := cw.Header()
+
+	if header.Get("Content-Type") == "" && cw.buf.Len() > 0 {
+		// Sniff it ourselves, the underlying ResponseWriter would
+		// only get to see the compressed bytes.
+		header.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+	}
+
+	if cw.shouldCompress(streaming) {
+		header.Set("Content-Encoding", cw.encoder.Encoding())
+		header.Del("Content-Length")
+		cw.writer = cw.encoder.NewWriter(cw.ResponseWriter)
+		return cw.send(cw.writer)
+	}
+	return cw.send(nil)
+}
+
+// Reports whether the response is worth compressing.
+func (cw *compressWriter) shouldCompress(streaming bool) bool {
+	header := cw.Header()
+	switch {
+	case cw.status == http.StatusNoContent,
+		cw.status == http.StatusNotModified,
+		cw.status == http.StatusPartialContent:
+		return false
+	case header.Get("Content-Encoding") != "":
+		return false
+	case !streaming && cw.buf.Len() < cw.options.MinSize:
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < cw.options.MinSize && !streaming {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	if i := strings.Index(contentType, ";"); i != -1 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, skip := range cw.options.SkipContentTypes {
+		if contentType == skip || (strings.HasSuffix(skip, "/") && strings.HasPrefix(contentType, skip)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Finishes the response once the handlers are done.
+func (cw *compressWriter) close() {
+	if !cw.committed {
+		if !cw.wroteHeader {
+			// Nothing has been written at all
+			return
+		}
+		cw.commit(false)
+	}
+	if cw.writer != nil {
+		cw.writer.Close()
+	}
+}
+
+// Quality values
+// --------------------------------
+
+// qualityValue is an item of a header like Accept-Encoding
+// together with its "q" parameter.
+type qualityValue struct {
+	value   string
+	quality float64
+}
+
+// Parses headers like "gzip;q=1.0, identity; q=0.5, *;q=0". Parameters
+// other than "q" are dropped. Items are kept in order.
+func parseQualityValues(header string) (values []qualityValue) {
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		value := strings.ToLower(strings.TrimSpace(parts[0]))
+		if value == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") || strings.HasPrefix(param, "Q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q >= 0 && q <= 1 {
+					quality = q
+				}
+			}
+		}
+		values = append(values, qualityValue{value, quality})
+	}
+	return
+}
+
+// Returns the quality for the given value and whether it was listed.
+func qualityOf(values []qualityValue, value string) (float64, bool) {
+	for _, item := range values {
+		if item.value == value {
+			return item.quality, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,325 @@
+package router
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoder(t *testing.T) {
+	encoders := []Encoder{GzipEncoder{}, DeflateEncoder{}}
+
+	type testPair struct {
+		acceptEncoding string
+		expected       string
+	}
+
+	testPairs := []testPair{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"br", ""},
+		{"*", "gzip"},
+		{"gzip;q=0, *;q=0.1", "deflate"},
+		{"identity", ""},
+	}
+
+	for _, test := range testPairs {
+		encoding := ""
+		if encoder := negotiateEncoder(encoders, test.acceptEncoding); encoder != nil {
+			encoding = encoder.Encoding()
+		}
+		if encoding != test.expected {
+			t.Error("Expected ", test.expected, " got ", encoding, " for ", test.acceptEncoding)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+	var size int
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Next(res, req)
+		size = Context(req).Response().Size()
+	})
+	aRouter.Mount("/", Compress(CompressOptions{}))
+	aRouter.Get("/large", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/plain")
+		res.Header().Set("ETag", `"large"`)
+		res.Write([]byte(large))
+	})
+	aRouter.Get("/small", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("hello"))
+	})
+	aRouter.Get("/image", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "image/png")
+		res.Write([]byte(large))
+	})
+	aRouter.Get("/encoded", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Encoding", "br")
+		res.Write([]byte(large))
+	})
+	aRouter.Get("/created", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusCreated)
+		res.Write([]byte(large[:600]))
+		res.Write([]byte(large[600:]))
+	})
+
+	// Compressed
+	req, _ := http.NewRequest("GET", "/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Header().Get("Content-Encoding") != "gzip" ||
+		res.Header().Get("Vary") != "Accept-Encoding" ||
+		res.Header().Get("Content-Type") != "text/plain" {
+		t.Error("Expected a gzipped response got ", res.Header())
+	}
+	if res.Header().Get("ETag") != `W/"large"` {
+		t.Error("Expected the ETag to be weakened got ", res.Header().Get("ETag"))
+	}
+	if size != res.Body.Len() || size >= len(large) {
+		t.Error("Expected the compressed size to be tracked got ", size)
+	}
+	if body := gunzip(t, res.Body); body != large {
+		t.Error("Expected the original body after decompressing got ", len(body), " bytes")
+	}
+
+	// Status codes are kept and writes can be split
+	req, _ = http.NewRequest("GET", "/created", nil)
+	req.Header.Set("Accept-Encoding", "deflate")
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusCreated || res.Header().Get("Content-Encoding") != "deflate" {
+		t.Error("Expected a deflated 201 got ", res.Code, res.Header())
+	}
+	if body, _ := ioutil.ReadAll(flate.NewReader(res.Body)); string(body) != large {
+		t.Error("Expected the original body after decompressing got ", len(body), " bytes")
+	}
+
+	// Not compressed
+	for _, path := range []string{"/small", "/image", "/encoded"} {
+		req, _ = http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		res = httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if encoding := res.Header().Get("Content-Encoding"); encoding == "gzip" {
+			t.Error("Expected no compression for ", path)
+		}
+		if res.Body.String() != "hello" && res.Body.String() != large {
+			t.Error("Expected the original body for ", path, " got ", res.Body.Len(), " bytes")
+		}
+	}
+
+	// The client does not accept compressed responses
+	req, _ = http.NewRequest("GET", "/large", nil)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Header().Get("Content-Encoding") != "" || res.Body.String() != large {
+		t.Error("Expected an uncompressed response got ", res.Header())
+	}
+}
+
+func TestCompressConditional(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", Compress(CompressOptions{}))
+	aRouter.Mount("/", Conditional(ConditionalOptions{}))
+	aRouter.Get("/large", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(large))
+	})
+	aRouter.Get("/small", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("hello"))
+	})
+
+	for _, path := range []string{"/large", "/small"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		etag := res.Header().Get("ETag")
+		if res.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+			t.Error("Expected a 200 with a weak ETag got ", res.Code, " ", etag, " for ", path)
+		}
+
+		// The 304 carries the same ETag as the 200
+		req.Header.Set("If-None-Match", etag)
+		res = httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNotModified || res.Header().Get("ETag") != etag {
+			t.Error("Expected a 304 with ETag ", etag, " got ", res.Code, " ", res.Header().Get("ETag"), " for ", path)
+		}
+	}
+}
+
+func TestCompressStreaming(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", Compress(CompressOptions{}))
+
+	flushed := make(chan bool)
+	proceed := make(chan bool)
+	aRouter.Get("/stream", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/event-stream")
+		res.Write([]byte("data: first\n\n"))
+		res.(http.Flusher).Flush()
+		flushed <- true
+		<-proceed
+		res.Write([]byte("data: second\n\n"))
+	})
+
+	server := httptest.NewServer(aRouter)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	go func() {
+		<-flushed
+		close(proceed)
+	}()
+
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("Expected the stream to be gzipped got ", res.Header)
+	}
+	zr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(zr)
+	if string(body) != "data: first\n\ndata: second\n\n" {
+		t.Error("Expected both events got ", string(body))
+	}
+}
+
+// A pluggable encoder, just reversing the body for testing
+type reverseEncoder struct{}
+
+func (encoder reverseEncoder) Encoding() string { return "reverse" }
+
+func (encoder reverseEncoder) NewWriter(w io.Writer) EncoderWriter {
+	return &reverseWriter{w: w}
+}
+
+type reverseWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (rw *reverseWriter) Write(data []byte) (int, error) {
+	rw.buf = append(rw.buf, data...)
+	return len(data), nil
+}
+
+func (rw *reverseWriter) Flush() error { return nil }
+
+func (rw *reverseWriter) Close() error {
+	for i, j := 0, len(rw.buf)-1; i < j; i, j = i+1, j-1 {
+		rw.buf[i], rw.buf[j] = rw.buf[j], rw.buf[i]
+	}
+	_, err := rw.w.Write(rw.buf)
+	return err
+}
+
+func TestCompressPluggableEncoder(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", Compress(CompressOptions{
+		Encoders: []Encoder{reverseEncoder{}, GzipEncoder{Level: gzip.BestSpeed}},
+		MinSize:  1,
+	}))
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("hello"))
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, reverse")
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Header().Get("Content-Encoding") != "reverse" || res.Body.String() != "olleh" {
+		t.Error("Expected the preferred encoder to be used got ", res.Header(), res.Body.String())
+	}
+}
+
+func TestCompressHijack(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", Compress(CompressOptions{}))
+
+	var compressed bool
+	aRouter.Get("/hijack", func(res http.ResponseWriter, req *http.Request) {
+		_, compressed = res.(*compressWriter)
+		conn, buf, err := res.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error("Expected the connection to be hijacked got ", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	})
+
+	server := httptest.NewServer(aRouter)
+	defer server.Close()
+
+	type testPair struct {
+		upgrade    string
+		compressed bool
+	}
+
+	testPairs := []testPair{
+		{"", true},
+		{"websocket", false},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", server.URL+"/hijack", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if test.upgrade != "" {
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", test.upgrade)
+		}
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if string(body) != "hijacked" || compressed != test.compressed {
+			t.Error("Expected the hijacked response got ", string(body), " compressing ", compressed, " for ", test.upgrade)
+		}
+	}
+}
+
+func gunzip(t *testing.T, body io.Reader) string {
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	io.Copy(&buf, zr)
+	return buf.String()
+}
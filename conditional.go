@@ -0,0 +1,207 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Conditional requests
+// --------------------------------
+
+// ConditionalOptions configures the Conditional handler.
+type ConditionalOptions struct {
+	WeakETags bool // Generate weak ETags, for responses which only differ in insignificant ways
+	MaxSize   int  // Larger responses are sent as they are written without ETag, defaults to 1MB
+}
+
+// Conditional returns a HandlerFunc answering conditional GET and HEAD
+// requests. Mount it so it applies to all routes.
+//
+//	appRouter.Mount("/", router.Conditional(router.ConditionalOptions{}))
+//
+// Successful responses are buffered to compute an ETag, unless the
+// handlers set one themselves. Requests with a matching If-None-Match,
+// or an If-Modified-Since not before the Last-Modified header set by the
+// handlers, get a 304 Not Modified. Requests with a failing If-Match or
+// If-Unmodified-Since get a 412 generated by the ErrorHandler.
+//
+// Handlers of unsafe methods check the preconditions themselves using
+// `cntxt.CheckPreconditions`, as only they know the current version.
+func Conditional(options ConditionalOptions) http.HandlerFunc {
+	if options.MaxSize == 0 {
+		options.MaxSize = 1 << 20
+	}
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			Context(req).Next(res, req)
+			return
+		}
+		cw := &conditionalWriter{req: req, options: &options}
+		cw.bufferedWriter = bufferedWriter{ResponseWriter: res, committer: cw, limit: options.MaxSize}
+		defer cw.close()
+		Context(req).Next(cw, req)
+	}
+}
+
+// CheckPreconditions evaluates the request's If-Match, If-Unmodified-Since,
+// If-None-Match and If-Modified-Since headers against the current version
+// of the resource, identified by its ETag and modification time. Pass an
+// empty ETag or zero time when unknown, an empty ETag for a resource which
+// does not exist.
+//
+//	appRouter.Put("/user/:userid", loadUser, func(res http.ResponseWriter, req *http.Request) {
+//		cntxt := router.Context(req)
+//		val, _ := cntxt.Get("user")
+//		user := val.(*User)
+//		if !cntxt.CheckPreconditions(res, req, user.ETag(), user.Updated) {
+//			return
+//		}
+//		...
+//	})
+//
+// It reports whether the request can proceed. If not, the response
+// has been sent: a 304 for GET and HEAD requests or a 412 generated
+// by the ErrorHandler.
+func (cntxt *RequestContext) CheckPreconditions(res http.ResponseWriter, req *http.Request, etag string, lastModified time.Time) bool {
+	switch evaluatePreconditions(req, etag, lastModified) {
+	case http.StatusNotModified:
+		if etag != "" {
+			res.Header().Set("ETag", etag)
+		}
+		res.WriteHeader(http.StatusNotModified)
+		return false
+	case http.StatusPreconditionFailed:
+		cntxt.Error(res, req, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// CacheControl returns a HandlerFunc setting the Cache-Control header.
+// Register it on a route to declare its caching policy.
+//
+//	appRouter.Get("/styles/:name", router.CacheControl("public, max-age=86400"), styles)
+func CacheControl(policy string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Cache-Control", policy)
+		Context(req).Next(res, req)
+	}
+}
+
+// Evaluates the preconditions in the order of RFC 9110, returning the status
+// code to respond with or 0 when the request can proceed.
+func evaluatePreconditions(req *http.Request, etag string, lastModified time.Time) int {
+	safe := req.Method == "GET" || req.Method == "HEAD"
+	lastModified = lastModified.Truncate(time.Second)
+
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		if !matchesETag(ifMatch, etag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(req.Header.Get("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		if lastModified.After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if matchesETag(ifNoneMatch, etag, false) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && safe && !lastModified.IsZero() {
+		if !lastModified.After(since) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// Reports whether the ETag is listed in the header, using the strong
+// comparison for If-Match and the weak one for If-None-Match.
+func matchesETag(header, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong {
+			if candidate == etag && !strings.HasPrefix(etag, "W/") {
+				return true
+			}
+		} else if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Computes the ETag of the body.
+func computeETag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		etag = "W/" + etag
+	}
+	return etag
+}
+
+// conditionalWriter holds on to successful responses to compute their ETag.
+type conditionalWriter struct {
+	bufferedWriter
+	req     *http.Request
+	options *ConditionalOptions
+}
+
+func (cw *conditionalWriter) WriteHeader(code int) {
+	cw.bufferedWriter.WriteHeader(code)
+	// Only successful responses get an ETag
+	if cw.wroteHeader && !cw.committed && cw.status != http.StatusOK {
+		cw.commit(false)
+	}
+}
+
+// Sends the headers and whatever has been buffered as it is.
+func (cw *conditionalWriter) commit(streaming bool) error {
+	return cw.send(nil)
+}
+
+// Finishes the response once the handlers are done, answering
+// the conditional request.
+func (cw *conditionalWriter) close() {
+	if cw.committed || !cw.wroteHeader {
+		return
+	}
+
+	header := cw.Header()
+	etag := header.Get("ETag")
+	// HEAD requests usually come without body to compute it from
+	if etag == "" && cw.buf.Len() > 0 {
+		etag = computeETag(cw.buf.Bytes(), cw.options.WeakETags)
+		header.Set("ETag", etag)
+	}
+	lastModified, _ := http.ParseTime(header.Get("Last-Modified"))
+
+	switch evaluatePreconditions(cw.req, etag, lastModified) {
+	case http.StatusNotModified:
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		cw.status = http.StatusNotModified
+		cw.buf.Reset()
+	case http.StatusPreconditionFailed:
+		cw.committed = true
+		header.Del("Content-Length")
+		Context(cw.req).Error(cw.ResponseWriter, cw.req, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+		return
+	}
+	cw.commit(false)
+}
@@ -0,0 +1,185 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluatePreconditions(t *testing.T) {
+	modified := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+	etag := `"abc"`
+
+	type testPair struct {
+		method   string
+		header   string
+		value    string
+		etag     string
+		expected int
+	}
+
+	testPairs := []testPair{
+		{"GET", "", "", etag, 0},
+		{"GET", "If-None-Match", `"abc"`, etag, http.StatusNotModified},
+		{"GET", "If-None-Match", `"xyz", W/"abc"`, etag, http.StatusNotModified},
+		{"GET", "If-None-Match", `"xyz"`, etag, 0},
+		{"GET", "If-None-Match", `*`, etag, http.StatusNotModified},
+		{"GET", "If-None-Match", `*`, "", 0},
+		{"PUT", "If-None-Match", `*`, etag, http.StatusPreconditionFailed},
+		{"PUT", "If-None-Match", `*`, "", 0},
+		{"GET", "If-Modified-Since", after, etag, http.StatusNotModified},
+		{"GET", "If-Modified-Since", modified.Format(http.TimeFormat), etag, http.StatusNotModified},
+		{"GET", "If-Modified-Since", before, etag, 0},
+		{"PUT", "If-Modified-Since", after, etag, 0},
+		{"PUT", "If-Match", `"abc"`, etag, 0},
+		{"PUT", "If-Match", `"xyz"`, etag, http.StatusPreconditionFailed},
+		{"PUT", "If-Match", `W/"abc"`, `W/"abc"`, http.StatusPreconditionFailed},
+		{"PUT", "If-Match", `*`, "", http.StatusPreconditionFailed},
+		{"PUT", "If-Unmodified-Since", after, etag, 0},
+		{"PUT", "If-Unmodified-Since", before, etag, http.StatusPreconditionFailed},
+		{"GET", "If-Match", `"xyz"`, etag, http.StatusPreconditionFailed},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest(test.method, "/", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		if status := evaluatePreconditions(req, test.etag, modified.Add(500*time.Millisecond)); status != test.expected {
+			t.Error("Expected ", test.expected, " got ", status, " for ", test.method, " ", test.header, ": ", test.value)
+		}
+	}
+}
+
+func TestConditional(t *testing.T) {
+	modified := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", Conditional(ConditionalOptions{}))
+	aRouter.Get("/user/:userid", CacheControl("private, max-age=60"), func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		res.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		res.Write([]byte(`{"id": "` + Context(req).Params["userid"] + `"}`))
+	})
+	aRouter.Get("/missing", func(res http.ResponseWriter, req *http.Request) {
+		http.Error(res, "not here", http.StatusNotFound)
+	})
+
+	req, _ := http.NewRequest("GET", "/user/14", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	etag := res.Header().Get("ETag")
+	if res.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) || res.Body.String() != `{"id": "14"}` {
+		t.Fatal("Expected the response with an ETag got ", res.Code, etag, res.Body.String())
+	}
+	if res.Header().Get("Cache-Control") != "private, max-age=60" {
+		t.Error("Expected the route's Cache-Control got ", res.Header().Get("Cache-Control"))
+	}
+
+	// Other content, other ETag
+	req, _ = http.NewRequest("GET", "/user/15", nil)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+	if res.Header().Get("ETag") == etag {
+		t.Error("Expected another ETag for other content")
+	}
+
+	// Not modified
+	for _, header := range [][2]string{{"If-None-Match", etag}, {"If-Modified-Since", modified.Format(http.TimeFormat)}} {
+		req, _ = http.NewRequest("GET", "/user/14", nil)
+		req.Header.Set(header[0], header[1])
+		res = httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != http.StatusNotModified || res.Body.Len() != 0 || res.Header().Get("ETag") != etag {
+			t.Error("Expected a 304 for ", header[0], " got ", res.Code, res.Body.String(), res.Header())
+		}
+	}
+
+	// Precondition failed
+	req, _ = http.NewRequest("GET", "/user/14", nil)
+	req.Header.Set("If-Match", `"other"`)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusPreconditionFailed {
+		t.Error("Expected a 412 got ", res.Code)
+	}
+
+	// Unsuccessful responses are left alone
+	req, _ = http.NewRequest("GET", "/missing", nil)
+	req.Header.Set("If-None-Match", "*")
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusNotFound || res.Header().Get("ETag") != "" {
+		t.Error("Expected the 404 as is got ", res.Code, res.Header())
+	}
+}
+
+func TestConditionalWeakAndLarge(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", Conditional(ConditionalOptions{WeakETags: true, MaxSize: 10}))
+	aRouter.Get("/small", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("small"))
+	})
+	aRouter.Get("/large", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("larger than ten bytes"))
+	})
+	aRouter.Get("/own", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("ETag", `"v1"`)
+		res.Write([]byte("own"))
+	})
+
+	req, _ := http.NewRequest("GET", "/small", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+	if !strings.HasPrefix(res.Header().Get("ETag"), `W/"`) {
+		t.Error("Expected a weak ETag got ", res.Header().Get("ETag"))
+	}
+
+	req, _ = http.NewRequest("GET", "/large", nil)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+	if res.Header().Get("ETag") != "" || res.Body.String() != "larger than ten bytes" {
+		t.Error("Expected large responses to be sent as is got ", res.Header())
+	}
+
+	req, _ = http.NewRequest("GET", "/own", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+	if res.Code != http.StatusNotModified {
+		t.Error("Expected the handler's ETag to be used got ", res.Code)
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	aRouter := NewRouter()
+	version := `"v2"`
+	aRouter.Put("/doc", func(res http.ResponseWriter, req *http.Request) {
+		if !Context(req).CheckPreconditions(res, req, version, time.Time{}) {
+			return
+		}
+		res.Write([]byte("updated"))
+	})
+
+	for _, test := range []struct {
+		ifMatch  string
+		expected int
+	}{{`"v2"`, http.StatusOK}, {`"v1"`, http.StatusPreconditionFailed}} {
+		req, _ := http.NewRequest("PUT", "/doc", nil)
+		req.Header.Set("If-Match", test.ifMatch)
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.expected {
+			t.Error("Expected ", test.expected, " got ", res.Code, " for ", test.ifMatch)
+		}
+	}
+}
@@ -2,23 +2,51 @@ package router
 
 import (
 	"net/http"
+	"sync"
 )
 
 // Context
 // --------------------------------
 
-// RequestContext contains data related to the current request
+// RequestContext contains data related to the current request.
+//
+// RequestContexts are reused between requests, so don't hold on to one
+// (or its RouteParams) once the request has been served.
 type RequestContext struct {
-	Params         map[string]string
+	Params         map[string]string // Route params by name, empty for routes without tokens
+	params         Params
 	inError        bool
+	aborted        bool
+	timedOut       bool
+	debug          bool
+	route          string
+	requestID      string
+	principal      *Principal
+	claims         Claims
+	csrfToken      string
+	cspNonce       string
+	body           *limitedBody
+	fieldErrors    FieldErrors
+	renderers      []Renderer
+	tracer         *Tracer
+	spans          []*Span
+	activeSpan     *Span
 	handlers       []http.HandlerFunc
 	currentHandler int
 	errorHandler   ErrorHandler
 	store          map[interface{}]interface{}
+	writer         responseWriter
+	response       ResponseWriter
+	wrappers       [16]ResponseWriter // Cached wrappers of writer, one for each combination of optional interfaces
+	lock           sync.Mutex         // Guards the fields above once a Timeout runs handlers in their own goroutine
+	served         bool               // The router is done serving the request
+	holds          int                // Number of handler chains still running in their own goroutine
 }
 
 // Context returns a pointer to the RequestContext for the current request.
 func Context(req *http.Request) *RequestContext {
+	requestContextStoreLock.RLock()
+	defer requestContextStoreLock.RUnlock()
 	return requestContextStore[req]
 }
 
@@ -27,8 +55,10 @@ func Context(req *http.Request) *RequestContext {
 // This is needed when multiple HandleFuncs are registered for a given path
 // and allows the creation and use of `middleware`.
 func (cntxt *RequestContext) Next(res http.ResponseWriter, req *http.Request) {
-	// Don't continue when erring
-	if cntxt.inError {
+	cntxt.lock.Lock()
+	// Don't continue when erring or aborted
+	if cntxt.inError || cntxt.aborted {
+		cntxt.lock.Unlock()
 		return
 	}
 	// For safety reasons, we ensure there is always an empty requestHandler to be
@@ -41,6 +71,12 @@ func (cntxt *RequestContext) Next(res http.ResponseWriter, req *http.Request) {
 		handler = cntxt.handlers[cntxt.currentHandler]
 	}
 	cntxt.currentHandler++
+	traced := cntxt.tracer != nil && cntxt.currentHandler <= len(cntxt.handlers)
+	cntxt.lock.Unlock()
+	if traced {
+		cntxt.traceHandler(handler, res, req)
+		return
+	}
 	handler(res, req)
 }
 
@@ -52,13 +88,126 @@ func (cntxt *RequestContext) Next(res http.ResponseWriter, req *http.Request) {
 // This allows loggers and such to finish what they started (though they can also
 // use a defer for that).
 func (cntxt *RequestContext) Error(res http.ResponseWriter, req *http.Request, err string, code int) {
+	cntxt.lock.Lock()
 	cntxt.inError = true
-	cntxt.errorHandler(res, req, err, code)
+	errorHandler := cntxt.errorHandler
+	cntxt.lock.Unlock()
+	errorHandler(res, req, err, code)
+}
+
+// Abort prevents the subsequent handlers from being executed without
+// responding with an error. Use it when the current handler generated
+// a complete response, like a redirect or a cached page.
+//
+// Just like with Error, code after the Next calls of previous
+// handlers will still execute.
+func (cntxt *RequestContext) Abort() {
+	cntxt.lock.Lock()
+	cntxt.aborted = true
+	cntxt.lock.Unlock()
+}
+
+// IsAborted reports whether Abort has been called for the current request.
+func (cntxt *RequestContext) IsAborted() bool {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	return cntxt.aborted
+}
+
+// Skip skips the next n handlers in line, so the following call to Next
+// dispatches the handler after them.
+//
+// The chain only moves forward: handlers already dispatched can't be
+// re-entered, so Skip does nothing when n is negative.
+func (cntxt *RequestContext) Skip(n int) {
+	if n <= 0 {
+		return
+	}
+	cntxt.lock.Lock()
+	cntxt.currentHandler += n
+	if cntxt.currentHandler > len(cntxt.handlers) {
+		cntxt.currentHandler = len(cntxt.handlers)
+	}
+	cntxt.lock.Unlock()
+}
+
+// Last invokes the final HandleFunc registered to handle this request,
+// skipping all the handlers in between. Nothing happens when the final
+// handler has already been dispatched.
+func (cntxt *RequestContext) Last(res http.ResponseWriter, req *http.Request) {
+	cntxt.lock.Lock()
+	if cntxt.currentHandler < len(cntxt.handlers)-1 {
+		cntxt.currentHandler = len(cntxt.handlers) - 1
+	}
+	cntxt.lock.Unlock()
+	cntxt.Next(res, req)
+}
+
+// Index returns the position in Handlers of the handler dispatched
+// most recently. Calling it from a handler before it calls Next
+// returns that handler's own position.
+func (cntxt *RequestContext) Index() int {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	if cntxt.currentHandler > len(cntxt.handlers) {
+		return len(cntxt.handlers) - 1
+	}
+	return cntxt.currentHandler - 1
+}
+
+// Remaining returns the number of handlers which have not been dispatched yet.
+func (cntxt *RequestContext) Remaining() int {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	if cntxt.currentHandler > len(cntxt.handlers) {
+		return 0
+	}
+	return len(cntxt.handlers) - cntxt.currentHandler
+}
+
+// Handlers returns all handlers dispatched for this request, the mounted
+// ones first followed by the ones registered for the route.
+func (cntxt *RequestContext) Handlers() []http.HandlerFunc {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	handlers := make([]http.HandlerFunc, len(cntxt.handlers))
+	copy(handlers, cntxt.handlers)
+	return handlers
+}
+
+// RouteParams returns the route params in the order their tokens appear
+// in the route path, including repeated names. Like Params, it is only
+// valid while the request is being served.
+func (cntxt *RequestContext) RouteParams() Params {
+	return cntxt.params
+}
+
+// Route returns the path the matched route was registered with,
+// like "/user/:userid".
+func (cntxt *RequestContext) Route() string {
+	return cntxt.route
+}
+
+// Response returns the ResponseWriter passed to the handlers, which
+// keeps track of the status code and number of bytes written.
+func (cntxt *RequestContext) Response() ResponseWriter {
+	return cntxt.response
+}
+
+// TimedOut reports whether a Timeout expired while serving the request.
+//
+// Mounted handlers like loggers can check it once their call to Next returns.
+func (cntxt *RequestContext) TimedOut() bool {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	return cntxt.timedOut
 }
 
 // Set saves a value for the current request.
 // The value will not be set if the key already exist.
 func (cntxt *RequestContext) Set(key, val interface{}) bool {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
 	// Lazily create the store
 	cntxt.makeStoreIfNotExist()
 	if cntxt.store[key] != nil {
@@ -71,6 +220,8 @@ func (cntxt *RequestContext) Set(key, val interface{}) bool {
 // ForceSet saves a value for the current request. Unlike Set,
 // it will happily override existing data.
 func (cntxt *RequestContext) ForceSet(key, val interface{}) {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
 	// Lazily create the store
 	cntxt.makeStoreIfNotExist()
 	cntxt.store[key] = val
@@ -78,6 +229,8 @@ func (cntxt *RequestContext) ForceSet(key, val interface{}) {
 
 // Get fetches data from the store associated with the current request.
 func (cntxt *RequestContext) Get(key interface{}) (val interface{}, ok bool) {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
 	// Lazily create the store
 	cntxt.makeStoreIfNotExist()
 	val, ok = cntxt.store[key]
@@ -86,6 +239,8 @@ func (cntxt *RequestContext) Get(key interface{}) (val interface{}, ok bool) {
 
 // Delete removes a key/value pair from the store.
 func (cntxt *RequestContext) Delete(key interface{}) {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
 	// Lazily create the store
 	cntxt.makeStoreIfNotExist()
 	delete(cntxt.store, key)
@@ -97,3 +252,84 @@ func (cntxt *RequestContext) makeStoreIfNotExist() {
 		cntxt.store = make(map[interface{}]interface{})
 	}
 }
+
+// Resets the requestContext so it can be reused for another request.
+// Params, RouteParams and the store keep their memory to prevent allocations.
+func (cntxt *RequestContext) reset() {
+	clear(cntxt.Params)
+	cntxt.params = cntxt.params[:0]
+	cntxt.inError = false
+	cntxt.aborted = false
+	cntxt.timedOut = false
+	cntxt.debug = false
+	cntxt.route = ""
+	cntxt.requestID = ""
+	cntxt.principal = nil
+	cntxt.claims = nil
+	cntxt.csrfToken = ""
+	cntxt.cspNonce = ""
+	cntxt.body = nil
+	cntxt.fieldErrors = nil
+	cntxt.renderers = nil
+	cntxt.tracer = nil
+	cntxt.spans = nil
+	cntxt.activeSpan = nil
+	cntxt.handlers = nil
+	cntxt.currentHandler = 0
+	cntxt.errorHandler = nil
+	for key := range cntxt.store {
+		delete(cntxt.store, key)
+	}
+	cntxt.writer.reset(nil)
+	cntxt.response = nil
+	cntxt.served = false
+	cntxt.holds = 0
+}
+
+// Dispatches the next handler with a request derived from the current one,
+// making sure the requestContext can be found for it.
+func (cntxt *RequestContext) nextWithRequest(res http.ResponseWriter, req *http.Request) {
+	storeContext(req, cntxt)
+	cntxt.Next(res, req)
+	deleteContext(req)
+}
+
+// Wraps the given ResponseWriter in the requestContext's ResponseWriter.
+//
+// The wrappers are cached so reused requestContexts don't need to
+// allocate them again.
+func (cntxt *RequestContext) wrapResponse(res http.ResponseWriter) ResponseWriter {
+	cntxt.writer.reset(res)
+	flags := cntxt.writer.implements()
+	if cntxt.wrappers[flags] == nil {
+		cntxt.wrappers[flags] = cntxt.writer.wrap(flags)
+	}
+	cntxt.response = cntxt.wrappers[flags]
+	return cntxt.response
+}
+
+// Marks the request as served and reports whether the requestContext
+// can be released, that is, when no timed out handler chain still uses it.
+func (cntxt *RequestContext) finish() bool {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	cntxt.served = true
+	return cntxt.holds == 0
+}
+
+// Marks the requestContext as being used by a handler chain
+// running in its own goroutine.
+func (cntxt *RequestContext) hold() {
+	cntxt.lock.Lock()
+	cntxt.holds++
+	cntxt.lock.Unlock()
+}
+
+// Marks a handler chain running in its own goroutine as done and reports
+// whether the requestContext can be released.
+func (cntxt *RequestContext) unhold() bool {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	cntxt.holds--
+	return cntxt.served && cntxt.holds == 0
+}
@@ -0,0 +1,116 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS
+// --------------------------------
+
+// CORSOptions configures the CORS handler.
+type CORSOptions struct {
+	AllowedOrigins   []string      // Origins allowed, "*" allows all and "https://*.example.com" all subdomains
+	AllowedHeaders   []string      // Request headers allowed, defaults to the ones asked for by the preflight request
+	ExposedHeaders   []string      // Response headers the browser may expose to the page
+	AllowCredentials bool          // Allow requests with cookies and credentials
+	MaxAge           time.Duration // How long browsers may cache the preflight response
+}
+
+// CORS returns a HandlerFunc adding the Cross-Origin Resource Sharing
+// headers to responses. Mount it before registering the routes.
+//
+//	appRouter.Mount("/", router.CORS(appRouter, router.CORSOptions{
+//		AllowedOrigins: []string{"https://*.example.com"},
+//	}))
+//
+// It answers preflight requests for every registered path, so there is no
+// need to register OPTIONS routes. To do so, it sets HandleOptions on the
+// router. The methods allowed are the ones routes have been registered for.
+//
+// Requests from origins which are not allowed are passed on without
+// CORS headers, so browsers will block the response.
+func CORS(router *Router, options CORSOptions) http.HandlerFunc {
+	router.HandleOptions = true
+
+	allowedHeaders := strings.Join(options.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(options.ExposedHeaders, ", ")
+	maxAge := ""
+	if options.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(options.MaxAge / time.Second))
+	}
+	allowAll := containsString(options.AllowedOrigins, "*")
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		header := res.Header()
+		origin := req.Header.Get("Origin")
+		preflight := req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != ""
+
+		// The response depends on the origin unless all origins get the same
+		if !allowAll || options.AllowCredentials {
+			header.Add("Vary", "Origin")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" || !isOriginAllowed(options.AllowedOrigins, origin) {
+			Context(req).Next(res, req)
+			return
+		}
+
+		if allowAll && !options.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if options.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			Context(req).Next(res, req)
+			return
+		}
+
+		// Answer the preflight request ourselves
+		methods, _ := router.allowedMethods(req.URL.Path)
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if allowedHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowedHeaders)
+		} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if maxAge != "" {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		res.WriteHeader(http.StatusNoContent)
+		Context(req).Abort()
+	}
+}
+
+// Reports whether the origin matches one of the allowed origins.
+func isOriginAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// Wildcard subdomains like "https://*.example.com"
+		if i := strings.Index(allowed, "*"); i != -1 {
+			prefix, suffix := strings.ToLower(allowed[:i]), strings.ToLower(allowed[i+1:])
+			lower := strings.ToLower(origin)
+			if len(lower) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(lower, prefix) &&
+				strings.HasSuffix(lower, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
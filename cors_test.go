@@ -0,0 +1,145 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHandleOptions(t *testing.T) {
+	aRouter := NewRouter()
+	handler := func(res http.ResponseWriter, req *http.Request) {}
+	aRouter.Get("/user/:userid", handler)
+	aRouter.Put("/user/:userid", handler)
+	aRouter.Delete("/user/:userid", handler)
+
+	req, _ := http.NewRequest("OPTIONS", "/user/14", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusNotFound {
+		t.Error("OPTIONS should not be answered unless HandleOptions is set, got ", res.Code)
+	}
+
+	aRouter.HandleOptions = true
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusNoContent ||
+		res.Header().Get("Allow") != "GET, PUT, DELETE, OPTIONS" {
+		t.Error("Expected 204 with the allowed methods got ", res.Code, res.Header())
+	}
+
+	req, _ = http.NewRequest("OPTIONS", "/unknown", nil)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusNotFound {
+		t.Error("OPTIONS for unregistered paths should not be found, got ", res.Code)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", CORS(aRouter, CORSOptions{
+		AllowedOrigins:   []string{"https://*.example.com", "https://other.org"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+
+	handler := func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("user"))
+	}
+	aRouter.Get("/user/:userid", handler)
+	aRouter.Patch("/user/:userid", handler)
+
+	req, _ := http.NewRequest("OPTIONS", "/user/14", nil)
+	req.Header.Set("Origin", "https://api.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PATCH")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":      "https://api.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, PATCH, OPTIONS",
+		"Access-Control-Allow-Headers":     "Content-Type",
+		"Access-Control-Max-Age":           "600",
+	}
+	if res.Code != http.StatusNoContent {
+		t.Error("Expected 204 got ", res.Code)
+	}
+	for key, val := range expected {
+		if got := res.Header().Get(key); got != val {
+			t.Error("Expected ", key, " to be ", val, " got ", got)
+		}
+	}
+	if vary := res.Header()["Vary"]; !reflect.DeepEqual(vary, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}) {
+		t.Error("Expected the response to vary on the CORS request headers got ", vary)
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", CORS(aRouter, CORSOptions{
+		AllowedOrigins: []string{"https://*.example.com", "https://other.org"},
+		ExposedHeaders: []string{"X-Total"},
+	}))
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("index"))
+	})
+
+	type testPair struct {
+		origin  string
+		allowed bool
+	}
+
+	testPairs := []testPair{
+		{"https://api.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://other.org", true},
+		{"https://OTHER.org", true},
+		{"https://example.com", false},
+		{"http://api.example.com", false},
+		{"https://evil.org", false},
+		{"https://example.com.evil.org", false},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Origin", test.origin)
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		allowOrigin := res.Header().Get("Access-Control-Allow-Origin")
+		if test.allowed && (allowOrigin != test.origin || res.Header().Get("Access-Control-Expose-Headers") != "X-Total") {
+			t.Error("Expected origin ", test.origin, " to be allowed got ", res.Header())
+		}
+		if !test.allowed && allowOrigin != "" {
+			t.Error("Expected origin ", test.origin, " not to be allowed got ", allowOrigin)
+		}
+		if res.Body.String() != "index" {
+			t.Error("Expected the request to be handled got ", res.Body.String())
+		}
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", CORS(aRouter, CORSOptions{AllowedOrigins: []string{"*"}}))
+	aRouter.Post("/", func(res http.ResponseWriter, req *http.Request) {})
+
+	req, _ := http.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://anywhere.org")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		res.Header().Get("Access-Control-Allow-Methods") != "POST, OPTIONS" {
+		t.Error("Expected all origins to be allowed got ", res.Header())
+	}
+}
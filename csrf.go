@@ -0,0 +1,201 @@
+package router
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CSRF
+// --------------------------------
+
+const csrfTokenLength = 32
+
+// CSRFOptions configures the CSRF handler.
+type CSRFOptions struct {
+	CookieName     string        // Cookie holding the secret token, defaults to "_csrf"
+	Header         string        // Header to read the token from, defaults to "X-CSRF-Token"
+	FormField      string        // Form field to read the token from, defaults to "csrf_token"
+	Secure         bool          // Only send the cookie over https, always done for TLS requests
+	SameSite       http.SameSite // SameSite attribute of the cookie, defaults to Lax
+	TrustedOrigins []string      // Other origins allowed to submit, like "https://*.example.com"
+	Exempt         []string      // Routes not checked, a trailing "*" matching all routes starting with it
+}
+
+// CSRF returns a HandlerFunc protecting against cross-site request forgery.
+// Mount it so all routes are protected.
+//
+//	appRouter.Mount("/", router.CSRF(router.CSRFOptions{
+//		Exempt: []string{"/webhooks/*"},
+//	}))
+//
+// A secret token is kept in a cookie. Every request gets a token derived
+// from it, use `cntxt.CSRFToken()` to render it in forms:
+//
+//	<input type="hidden" name="csrf_token" value="{{ .CSRFToken }}">
+//
+// POST, PUT, PATCH and DELETE requests need to send it back in the form
+// field or the X-CSRF-Token header. Their Origin or Referer, when sent,
+// needs to be the site itself or one of the TrustedOrigins.
+//
+// Exempt holds the routes, as registered, not checked. Failing requests
+// get a 403 generated by the ErrorHandler.
+func CSRF(options CSRFOptions) http.HandlerFunc {
+	if options.CookieName == "" {
+		options.CookieName = "_csrf"
+	}
+	if options.Header == "" {
+		options.Header = "X-CSRF-Token"
+	}
+	if options.FormField == "" {
+		options.FormField = "csrf_token"
+	}
+	if options.SameSite == 0 {
+		options.SameSite = http.SameSiteLaxMode
+	}
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+
+		secret := csrfSecret(req, options.CookieName)
+		if secret == nil {
+			secret = make([]byte, csrfTokenLength)
+			if _, err := rand.Read(secret); err != nil {
+				cntxt.Error(res, req, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(res, &http.Cookie{
+				Name:     options.CookieName,
+				Value:    base64.RawURLEncoding.EncodeToString(secret),
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   options.Secure || req.TLS != nil,
+				SameSite: options.SameSite,
+			})
+		}
+
+		cntxt.lock.Lock()
+		cntxt.csrfToken = maskCSRFToken(secret)
+		cntxt.lock.Unlock()
+		res.Header().Add("Vary", "Cookie")
+
+		if isSafeMethod(req.Method) || isExemptRoute(options.Exempt, cntxt.Route()) {
+			cntxt.Next(res, req)
+			return
+		}
+
+		if !isSameOrigin(req, options.TrustedOrigins) {
+			cntxt.Error(res, req, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		token := req.Header.Get(options.Header)
+		if token == "" {
+			token = req.PostFormValue(options.FormField)
+		}
+		if !isValidCSRFToken(token, secret) {
+			cntxt.Error(res, req, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		cntxt.Next(res, req)
+	}
+}
+
+// CSRFToken returns the token to include in forms or send in the
+// X-CSRF-Token header, as issued by the CSRF handler.
+func (cntxt *RequestContext) CSRFToken() string {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	return cntxt.csrfToken
+}
+
+// Returns the secret token from the cookie, nil when there is none.
+func csrfSecret(req *http.Request, name string) []byte {
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		return nil
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || len(secret) != csrfTokenLength {
+		return nil
+	}
+	return secret
+}
+
+// Masks the secret with a random pad, so the token in the page differs on
+// every request and can't be recovered by compression attacks like BREACH.
+func maskCSRFToken(secret []byte) string {
+	token := make([]byte, 2*csrfTokenLength)
+	pad, masked := token[:csrfTokenLength], token[csrfTokenLength:]
+	rand.Read(pad)
+	for i := range secret {
+		masked[i] = secret[i] ^ pad[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// Reports whether the masked token was derived from the secret.
+func isValidCSRFToken(token string, secret []byte) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(decoded) != 2*csrfTokenLength {
+		return false
+	}
+	pad, masked := decoded[:csrfTokenLength], decoded[csrfTokenLength:]
+	unmasked := make([]byte, csrfTokenLength)
+	for i := range masked {
+		unmasked[i] = masked[i] ^ pad[i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
+
+// Reports whether the request does not change state.
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS" || method == "TRACE"
+}
+
+// Reports whether the route matches one of the patterns.
+func isExemptRoute(patterns []string, route string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(route, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if route == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the request was sent from the site itself or a trusted
+// origin, judging by the Origin header or else the Referer. Requests
+// without either are left to the token check.
+func isSameOrigin(req *http.Request, trustedOrigins []string) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		referer := req.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+		refererURL, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+		origin = refererURL.Scheme + "://" + refererURL.Host
+	}
+	if origin == "null" {
+		return false
+	}
+
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(originURL.Host, req.Host) {
+		return true
+	}
+	return isOriginAllowed(trustedOrigins, origin)
+}
@@ -0,0 +1,109 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", CSRF(CSRFOptions{
+		TrustedOrigins: []string{"https://*.example.org"},
+		Exempt:         []string{"/webhooks/*", "/ping"},
+	}))
+
+	aRouter.Get("/form", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(Context(req).CSRFToken()))
+	})
+	submit := func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("submitted"))
+	}
+	aRouter.Post("/form", submit)
+	aRouter.Delete("/item/:itemid", submit)
+	aRouter.Post("/webhooks/:provider", submit)
+	aRouter.Post("/ping", submit)
+
+	// Get the form, issuing the cookie and a token
+	req, _ := http.NewRequest("GET", "http://example.com/form", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "_csrf" || !cookies[0].HttpOnly {
+		t.Fatal("Expected the secret cookie to be set got ", cookies)
+	}
+	cookie := cookies[0]
+	token := res.Body.String()
+
+	// Tokens differ on each request but all stay valid
+	req, _ = http.NewRequest("GET", "http://example.com/form", nil)
+	req.AddCookie(cookie)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	otherToken := res.Body.String()
+	if otherToken == token || len(res.Result().Cookies()) != 0 {
+		t.Error("Expected a new token for the same cookie got ", otherToken)
+	}
+
+	type testPair struct {
+		name     string
+		method   string
+		path     string
+		cookie   bool
+		header   string
+		form     string
+		origin   string
+		referer  string
+		expected int
+	}
+
+	testPairs := []testPair{
+		{"header", "POST", "/form", true, token, "", "", "", http.StatusOK},
+		{"form field", "POST", "/form", true, "", otherToken, "", "", http.StatusOK},
+		{"delete", "DELETE", "/item/14", true, token, "", "", "", http.StatusOK},
+		{"same origin", "POST", "/form", true, token, "", "http://example.com", "", http.StatusOK},
+		{"same origin referer", "POST", "/form", true, token, "", "", "http://example.com/form", http.StatusOK},
+		{"trusted origin", "POST", "/form", true, token, "", "https://app.example.org", "", http.StatusOK},
+		{"missing token", "POST", "/form", true, "", "", "", "", http.StatusForbidden},
+		{"missing cookie", "POST", "/form", false, token, "", "", "", http.StatusForbidden},
+		{"tampered token", "POST", "/form", true, token[:len(token)-2] + "AA", "", "", "", http.StatusForbidden},
+		{"other origin", "POST", "/form", true, token, "", "https://evil.com", "", http.StatusForbidden},
+		{"other referer", "POST", "/form", true, token, "", "", "https://evil.com/form", http.StatusForbidden},
+		{"null origin", "DELETE", "/item/14", true, token, "", "null", "", http.StatusForbidden},
+		{"exempt group", "POST", "/webhooks/github", false, "", "", "https://github.com", "", http.StatusOK},
+		{"exempt route", "POST", "/ping", false, "", "", "", "", http.StatusOK},
+	}
+
+	for _, test := range testPairs {
+		var req *http.Request
+		if test.form != "" {
+			body := url.Values{"csrf_token": {test.form}}.Encode()
+			req, _ = http.NewRequest(test.method, "http://example.com"+test.path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req, _ = http.NewRequest(test.method, "http://example.com"+test.path, nil)
+		}
+		if test.cookie {
+			req.AddCookie(cookie)
+		}
+		if test.header != "" {
+			req.Header.Set("X-CSRF-Token", test.header)
+		}
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if test.referer != "" {
+			req.Header.Set("Referer", test.referer)
+		}
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.expected {
+			t.Error("Expected ", test.expected, " got ", res.Code, " for ", test.name)
+		}
+	}
+}
@@ -21,11 +21,8 @@ Basic usage
 		res.Write([]byte("hello"))
 	})
 
-	// Use this router
-	appRouter.Handle("/")
-
-	// Listen for requests
-	http.ListenAndServe(":3000", nil)
+	// Listen for requests until interrupted
+	log.Fatal(appRouter.Run(":3000"))
 
 More advanced usage
 
@@ -40,8 +37,7 @@ More advanced usage
 		// `:userid` specifies the param `userid` so it will match any string.
 		appRouter.Get("/user/:userid/hello", loadUser, handleUser)
 
-		appRouter.Handle("/")
-		http.ListenAndServe(":3000", nil)
+		log.Fatal(appRouter.Run(":3000"))
 	}
 
 	func logger(res http.ResponseWriter, req *http.Request) {
@@ -8,12 +8,13 @@
 //
 // Check the logger output on the command line.
 // You'll see something like
-//      `GET /user/20/hello 5.916us`
+//      `GET /user/20/hello 200 19 5.916us`
 package main
 
 import (
 	"fmt"
 	"github.com/toonketels/router"
+	"log"
 	"net/http"
 	"time"
 )
@@ -29,8 +30,7 @@ func main() {
 	// `:userid` specifies the param `userid` so it will match any string.
 	appRouter.Get("/user/:userid/hello", loadUser, handleUser)
 
-	appRouter.Handle("/")
-	http.ListenAndServe(":3000", nil)
+	log.Fatal(appRouter.Run(":3000"))
 }
 
 func logger(res http.ResponseWriter, req *http.Request) {
@@ -47,7 +47,8 @@ func logger(res http.ResponseWriter, req *http.Request) {
 
 	// We log once all other handlerFuncs are done executing
 	// so it needs to come after our call to cntxt.Next()
-	fmt.Println(req.Method, req.URL.Path, time.Since(start))
+	response := router.Context(req).Response()
+	fmt.Println(req.Method, req.URL.Path, response.Status(), response.Size(), time.Since(start))
 }
 
 func loadUser(res http.ResponseWriter, req *http.Request) {
@@ -9,6 +9,7 @@ package main
 
 import (
 	"github.com/toonketels/router"
+	"log"
 	"net/http"
 )
 
@@ -21,9 +22,6 @@ func main() {
 		res.Write([]byte("hello"))
 	})
 
-	// Use this router
-	appRouter.Handle("/")
-
-	// Listen for requests
-	http.ListenAndServe(":3000", nil)
+	// Listen for requests until interrupted
+	log.Fatal(appRouter.Run(":3000"))
 }
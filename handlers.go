@@ -20,10 +20,10 @@ type requestHandler struct {
 
 // matches checks if the given handler matches the given given string.
 //
-// It will also return to which uservalues the params evaluate for this path.
-func (reqHandler *requestHandler) matches(path string) (isAMatch bool, withParams map[string]string) {
-	withParams = make(map[string]string)
-	isAMatch = false
+// The uservalues the params evaluate to for this path are appended to
+// params, so callers can pass in a buffer to be reused.
+func (reqHandler *requestHandler) matches(path string, params Params) (isAMatch bool, withParams Params) {
+	withParams = params
 
 	// Compare strings only when we know the path registered
 	// does not contain tokens
@@ -33,11 +33,14 @@ func (reqHandler *requestHandler) matches(path string) (isAMatch bool, withParam
 	}
 
 	// Compare via regexp when the path does contain tokens
-	matches := reqHandler.Regex.FindAllStringSubmatch(path, -1)
+	match := reqHandler.Regex.FindStringSubmatchIndex(path)
 	// Only try to find the params if we have a match
-	if isAMatch = len(matches) != 0; isAMatch {
+	if isAMatch = match != nil; isAMatch {
 		for i, paramName := range reqHandler.ParamNames {
-			withParams[paramName] = matches[0][i+1]
+			withParams = append(withParams, Param{
+				Name:  paramName,
+				Value: path[match[2*i+2]:match[2*i+3]],
+			})
 		}
 	}
 	return
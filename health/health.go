@@ -0,0 +1,243 @@
+// Package health serves health, readiness and liveness endpoints
+// for a router, reporting on checks of the app's dependencies.
+//
+//	checks := health.New()
+//	checks.Add("database", db.PingContext, health.CheckOptions{
+//		Timeout:  time.Second,
+//		Critical: true,
+//		CacheFor: 5 * time.Second,
+//	})
+//	checks.Add("search", pingSearch, health.CheckOptions{})
+//	checks.Register(appRouter)
+//
+// This registers:
+//
+//	/healthz  runs all checks and reports on them
+//	/readyz   like /healthz, but also fails once shutting down
+//	/livez    only runs the checks marked as Liveness
+//
+// They respond with a 200, or a 503 when a critical check fails or
+// /readyz is shutting down. Failing checks which are not critical are
+// reported as degraded. The response holds the details as JSON:
+//
+//	{
+//		"status": "degraded",
+//		"checks": [
+//			{"name": "database", "status": "ok", "critical": true, "duration": "1.2ms"},
+//			{"name": "search", "status": "failing", "critical": false, "duration": "1s", "error": "timed out"}
+//		]
+//	}
+//
+// Call Shutdown when the server starts shutting down, so load balancers
+// stop sending requests while the ones in flight are drained.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/toonketels/router"
+)
+
+// Statuses reported for checks and overall.
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFailing  = "failing"
+)
+
+// Check checks a dependency, returning an error when it is unhealthy.
+// It should give up when the context is done.
+type Check func(ctx context.Context) error
+
+// CheckOptions configures a check.
+type CheckOptions struct {
+	Timeout  time.Duration // Time the check may take, defaults to 5 seconds
+	Critical bool          // Whether the app can't serve requests when the check fails
+	CacheFor time.Duration // How long the result is reused, not at all when 0
+	Liveness bool          // Whether the check is run for /livez too
+}
+
+// Health holds the checks of an app.
+type Health struct {
+	lock         sync.Mutex
+	checks       []*check
+	shuttingDown bool
+}
+
+type check struct {
+	name    string
+	check   Check
+	options CheckOptions
+	lock    sync.Mutex // Held while checking, so concurrent requests share the result
+	result  Result
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Duration  string    `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the outcome of all checks.
+type Report struct {
+	Status       string   `json:"status"`
+	ShuttingDown bool     `json:"shutting_down,omitempty"`
+	Checks       []Result `json:"checks"`
+}
+
+// New creates a Health without checks.
+func New() *Health {
+	return &Health{}
+}
+
+// Add adds a check.
+func (health *Health) Add(name string, fn Check, options CheckOptions) {
+	if options.Timeout == 0 {
+		options.Timeout = 5 * time.Second
+	}
+	health.lock.Lock()
+	health.checks = append(health.checks, &check{name: name, check: fn, options: options})
+	health.lock.Unlock()
+}
+
+// Register registers the /healthz, /readyz and /livez endpoints on the router.
+func (health *Health) Register(appRouter *router.Router) {
+	appRouter.Get("/healthz", health.Healthz)
+	appRouter.Get("/readyz", health.Readyz)
+	appRouter.Get("/livez", health.Livez)
+}
+
+// Shutdown makes readiness fail from now on.
+func (health *Health) Shutdown() {
+	health.lock.Lock()
+	health.shuttingDown = true
+	health.lock.Unlock()
+}
+
+// Healthz runs all checks and reports on them.
+func (health *Health) Healthz(res http.ResponseWriter, req *http.Request) {
+	respond(res, health.runChecks(req.Context(), false))
+}
+
+// Readyz runs all checks and reports on them, failing once shutting down.
+func (health *Health) Readyz(res http.ResponseWriter, req *http.Request) {
+	respond(res, health.Check(req.Context(), false))
+}
+
+// Livez runs the liveness checks and reports on them.
+func (health *Health) Livez(res http.ResponseWriter, req *http.Request) {
+	respond(res, health.runChecks(req.Context(), true))
+}
+
+// Check runs the checks concurrently, only the liveness checks when
+// asked to, and reports on them. Reports are failing once shutting down.
+func (health *Health) Check(ctx context.Context, liveness bool) Report {
+	report := health.runChecks(ctx, liveness)
+	health.lock.Lock()
+	report.ShuttingDown = health.shuttingDown
+	health.lock.Unlock()
+	if report.ShuttingDown {
+		report.Status = StatusFailing
+	}
+	return report
+}
+
+// Runs the checks concurrently and reports on them, regardless of
+// shutting down.
+func (health *Health) runChecks(ctx context.Context, liveness bool) Report {
+	health.lock.Lock()
+	checks := make([]*check, 0, len(health.checks))
+	for _, c := range health.checks {
+		if !liveness || c.options.Liveness {
+			checks = append(checks, c)
+		}
+	}
+	report := Report{Status: StatusOK}
+	health.lock.Unlock()
+
+	report.Checks = make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == StatusOK {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusFailing
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// Runs the check, unless its cached result can be used.
+func (c *check) run(ctx context.Context) Result {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if !c.result.CheckedAt.IsZero() && now.Sub(c.result.CheckedAt) < c.options.CacheFor {
+		return c.result
+	}
+
+	// The result can be cached, so a client going away must not fail it
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.options.Timeout)
+	defer cancel()
+
+	// Don't wait on checks ignoring the context
+	done := make(chan error, 1)
+	go func() {
+		done <- c.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Name:      c.name,
+		Status:    StatusOK,
+		Critical:  c.options.Critical,
+		Duration:  time.Since(now).String(),
+		CheckedAt: now,
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+		if err == context.DeadlineExceeded {
+			result.Error = "timed out"
+		}
+	}
+	c.result = result
+	return result
+}
+
+func respond(res http.ResponseWriter, report Report) {
+	status := http.StatusOK
+	if report.Status == StatusFailing {
+		status = http.StatusServiceUnavailable
+	}
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(report)
+}
@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/toonketels/router"
+)
+
+func TestHealth(t *testing.T) {
+	var databaseDown, searchDown int32
+	checks := New()
+	checks.Add("database", func(ctx context.Context) error {
+		if atomic.LoadInt32(&databaseDown) == 1 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, CheckOptions{Critical: true})
+	checks.Add("search", func(ctx context.Context) error {
+		if atomic.LoadInt32(&searchDown) == 1 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, CheckOptions{})
+	checks.Add("deadlock", func(ctx context.Context) error {
+		return nil
+	}, CheckOptions{Critical: true, Liveness: true})
+
+	appRouter := router.NewRouter()
+	checks.Register(appRouter)
+
+	type testPair struct {
+		databaseDown int32
+		searchDown   int32
+		shutdown     bool
+		path         string
+		code         int
+		status       string
+		checks       int
+	}
+
+	testPairs := []testPair{
+		{0, 0, false, "/healthz", http.StatusOK, StatusOK, 3},
+		{0, 1, false, "/healthz", http.StatusOK, StatusDegraded, 3},
+		{1, 1, false, "/healthz", http.StatusServiceUnavailable, StatusFailing, 3},
+		{1, 1, false, "/readyz", http.StatusServiceUnavailable, StatusFailing, 3},
+		{1, 1, false, "/livez", http.StatusOK, StatusOK, 1},
+		{0, 0, false, "/readyz", http.StatusOK, StatusOK, 3},
+		{0, 0, true, "/readyz", http.StatusServiceUnavailable, StatusFailing, 3},
+		{0, 0, true, "/healthz", http.StatusOK, StatusOK, 3},
+		{0, 0, true, "/livez", http.StatusOK, StatusOK, 1},
+	}
+
+	for _, test := range testPairs {
+		atomic.StoreInt32(&databaseDown, test.databaseDown)
+		atomic.StoreInt32(&searchDown, test.searchDown)
+		if test.shutdown {
+			checks.Shutdown()
+		}
+
+		req, _ := http.NewRequest("GET", test.path, nil)
+		res := httptest.NewRecorder()
+		appRouter.ServeHTTP(res, req)
+
+		var report Report
+		if err := json.Unmarshal(res.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if res.Code != test.code || report.Status != test.status || len(report.Checks) != test.checks {
+			t.Error("Expected ", test.code, test.status, test.checks, " got ", res.Code, report.Status, len(report.Checks), " for ", test.path)
+		}
+		if res.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+			t.Error("Expected a JSON response got ", res.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestHealthTimeout(t *testing.T) {
+	checks := New()
+	block := make(chan bool)
+	defer close(block)
+	checks.Add("stuck", func(ctx context.Context) error {
+		// Ignores the context
+		<-block
+		return nil
+	}, CheckOptions{Timeout: 10 * time.Millisecond, Critical: true})
+
+	report := checks.Check(context.Background(), false)
+	if report.Status != StatusFailing || report.Checks[0].Error != "timed out" {
+		t.Error("Expected the check to time out got ", report)
+	}
+}
+
+func TestHealthCacheFor(t *testing.T) {
+	var calls int32
+	checks := New()
+	checks.Add("cached", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, CheckOptions{CacheFor: time.Minute})
+	checks.Add("uncached", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}, CheckOptions{})
+
+	for i := 0; i < 3; i++ {
+		checks.Check(context.Background(), false)
+	}
+	if calls != 4 {
+		t.Error("Expected the cached check to run once got ", calls, " calls")
+	}
+}
+
+func TestHealthCanceledRequest(t *testing.T) {
+	checks := New()
+	checks.Add("cached", func(ctx context.Context) error {
+		return ctx.Err()
+	}, CheckOptions{CacheFor: time.Minute, Critical: true})
+
+	// The client went away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checks.Check(ctx, false)
+
+	report := checks.Check(context.Background(), false)
+	if report.Status != StatusOK || report.Checks[0].Error != "" {
+		t.Error("Expected a canceled request not to fail the check got ", report)
+	}
+}
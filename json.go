@@ -0,0 +1,223 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSON
+// --------------------------------
+
+// Maximum size of JSON bodies when the router or route sets no body limit.
+const defaultMaxJSONBytes = 1 << 20
+
+// BindJSON decodes the JSON request body into v. When the body can't be
+// decoded, the ErrorHandler responds and false is returned, so the
+// handler can simply return.
+//
+//	var user User
+//	if !cntxt.BindJSON(res, req, &user) {
+//		return
+//	}
+//
+// Responds with a:
+//   - 415 when the Content-Type is not JSON.
+//   - 413 when the body is larger than the limit set by the router's
+//     MaxBodyBytes or a BodyLimit handler, 1MB when neither is set.
+//   - 400 when the body is not a single JSON value matching v. Fields
+//     not in v are not allowed.
+func (cntxt *RequestContext) BindJSON(res http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if !isJSONContentType(req.Header.Get("Content-Type")) {
+		cntxt.Error(res, req, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	body := io.Reader(http.NoBody)
+	if req.Body != nil {
+		body = req.Body
+		if !cntxt.hasBodyLimit() {
+			body = http.MaxBytesReader(cntxt.writer.ResponseWriter, req.Body, defaultMaxJSONBytes)
+		}
+	}
+
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil {
+		// Catch what follows the value, like "{} {}"
+		if _, err = decoder.Token(); err == io.EOF {
+			return true
+		}
+		var syntaxErr *json.SyntaxError
+		if err == nil || errors.As(err, &syntaxErr) {
+			err = errors.New("body must hold a single JSON value")
+		}
+	}
+
+	code, message := http.StatusBadRequest, jsonErrorMessage(err)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		code, message = http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge)
+	} else if errors.Is(err, ErrBodyTooSlow) {
+		code, message = http.StatusRequestTimeout, http.StatusText(http.StatusRequestTimeout)
+	}
+	cntxt.Error(res, req, message, code)
+	return false
+}
+
+// JSON responds with v encoded as JSON, pretty printed when the router
+// is in Debug mode. When v can't be encoded, nothing is written and the
+// error is returned.
+//
+//	cntxt.JSON(res, http.StatusOK, user)
+func (cntxt *RequestContext) JSON(res http.ResponseWriter, code int, v interface{}) error {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	if cntxt.debug {
+		encoder.SetIndent("", "  ")
+	}
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	res.Header().Set("Content-Length", strconv.Itoa(out.Len()))
+	res.WriteHeader(code)
+	_, err := res.Write(out.Bytes())
+	return err
+}
+
+// JSONStream writes a JSON array one element at a time, for results too
+// large to hold in memory.
+//
+//	stream := cntxt.StreamJSON(res, http.StatusOK)
+//	for rows.Next() {
+//		// ...scan the row into user
+//		if err := stream.Encode(user); err != nil {
+//			return
+//		}
+//	}
+//	stream.Close()
+//
+// The status has been sent once streaming starts, errors can't be
+// reported to the client other than by closing the stream early.
+type JSONStream struct {
+	res     http.ResponseWriter
+	encoder *json.Encoder
+	count   int
+	err     error
+}
+
+// StreamJSON starts responding with a JSON array, see JSONStream.
+func (cntxt *RequestContext) StreamJSON(res http.ResponseWriter, code int) *JSONStream {
+	stream := &JSONStream{res: res, encoder: json.NewEncoder(res)}
+	if cntxt.debug {
+		stream.encoder.SetIndent("", "  ")
+	}
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	res.WriteHeader(code)
+	_, stream.err = io.WriteString(res, "[")
+	return stream
+}
+
+// Encode writes v as the next element of the array.
+func (stream *JSONStream) Encode(v interface{}) error {
+	if stream.err != nil {
+		return stream.err
+	}
+	if stream.count > 0 {
+		if _, stream.err = io.WriteString(stream.res, ","); stream.err != nil {
+			return stream.err
+		}
+	}
+	stream.count++
+	stream.err = stream.encoder.Encode(v)
+	return stream.err
+}
+
+// Flush sends the elements written so far to the client.
+func (stream *JSONStream) Flush() error {
+	if stream.err != nil {
+		return stream.err
+	}
+	return http.NewResponseController(stream.res).Flush()
+}
+
+// Close ends the array.
+func (stream *JSONStream) Close() error {
+	if stream.err != nil {
+		return stream.err
+	}
+	_, stream.err = io.WriteString(stream.res, "]\n")
+	return stream.err
+}
+
+// Reports whether the media type is "application/json"
+// or a JSON based one like "application/problem+json".
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" ||
+		strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")
+}
+
+// Reports whether the router's MaxBodyBytes or a BodyLimit
+// handler limits the request body.
+func (cntxt *RequestContext) hasBodyLimit() bool {
+	if cntxt.body == nil {
+		return false
+	}
+	cntxt.body.lock.Lock()
+	defer cntxt.body.lock.Unlock()
+	return cntxt.body.limit > 0
+}
+
+// Describes why decoding failed without exposing Go types.
+func jsonErrorMessage(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return "invalid JSON at offset " + strconv.FormatInt(syntaxErr.Offset, 10)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return "body must be a JSON " + jsonKind(typeErr.Type.Kind())
+		}
+		return "field " + strconv.Quote(typeErr.Field) + " must be a JSON " + jsonKind(typeErr.Type.Kind())
+	case err == io.EOF:
+		return "body must not be empty"
+	case err == io.ErrUnexpectedEOF:
+		return "body holds incomplete JSON"
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return "unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	}
+	return err.Error()
+}
+
+// Names the JSON type values of a Go kind are decoded from.
+func jsonKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return "value"
+}
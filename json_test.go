@@ -0,0 +1,149 @@
+package router
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type jsonUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestBindJSON(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Post("/user", func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		var user jsonUser
+		if !cntxt.BindJSON(res, req, &user) {
+			return
+		}
+		res.Write([]byte(user.Name))
+	})
+	aRouter.Post("/upload", BodyLimit(BodyLimitOptions{MaxBytes: 2 << 20}), func(res http.ResponseWriter, req *http.Request) {
+		var users []jsonUser
+		if Context(req).BindJSON(res, req, &users) {
+			res.Write([]byte("uploaded"))
+		}
+	})
+
+	large := "[" + strings.Repeat(`{"name":"toon","age":34},`, 50000) + `{}]`
+
+	type testPair struct {
+		path        string
+		contentType string
+		body        string
+		code        int
+		response    string
+	}
+
+	testPairs := []testPair{
+		{"/user", "application/json", `{"name":"toon","age":34}`, http.StatusOK, "toon"},
+		{"/user", "application/json; charset=utf-8", `{"name":"toon"}`, http.StatusOK, "toon"},
+		{"/user", "application/merge-patch+json", `{"name":"toon"}`, http.StatusOK, "toon"},
+		{"/user", "text/plain", `{"name":"toon"}`, http.StatusUnsupportedMediaType, "Unsupported Media Type\n"},
+		{"/user", "", `{"name":"toon"}`, http.StatusUnsupportedMediaType, "Unsupported Media Type\n"},
+		{"/user", "application/json", `{"name":"toon","admin":true}`, http.StatusBadRequest, "unknown field \"admin\"\n"},
+		{"/user", "application/json", `{"name":"toon","age":"old"}`, http.StatusBadRequest, "field \"age\" must be a JSON number\n"},
+		{"/user", "application/json", `["toon"]`, http.StatusBadRequest, "body must be a JSON object\n"},
+		{"/user", "application/json", `{"name":"toon",}`, http.StatusBadRequest, "invalid JSON at offset 16\n"},
+		{"/user", "application/json", `{"name":"toon"`, http.StatusBadRequest, "body holds incomplete JSON\n"},
+		{"/user", "application/json", `{"name":"toon"} {}`, http.StatusBadRequest, "body must hold a single JSON value\n"},
+		{"/user", "application/json", `{"name":"toon"}x`, http.StatusBadRequest, "body must hold a single JSON value\n"},
+		{"/user", "application/json", ``, http.StatusBadRequest, "body must not be empty\n"},
+		{"/user", "application/json", large, http.StatusRequestEntityTooLarge, "Request Entity Too Large\n"},
+		{"/upload", "application/json", large, http.StatusOK, "uploaded"},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("POST", test.path, strings.NewReader(test.body))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.code || res.Body.String() != test.response {
+			t.Error("Expected ", test.code, " ", test.response, " got ", res.Code, " ", res.Body.String(), " for ", test.body[:min(len(test.body), 40)])
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Get("/user", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).JSON(res, http.StatusCreated, jsonUser{Name: "toon", Age: 34})
+	})
+	aRouter.Get("/invalid", func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		if err := cntxt.JSON(res, http.StatusOK, math.Inf(1)); err != nil {
+			cntxt.Error(res, req, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	req, _ := http.NewRequest("GET", "/user", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusCreated || res.Body.String() != "{\"name\":\"toon\",\"age\":34}\n" {
+		t.Error("Expected the user as JSON got ", res.Code, " ", res.Body.String())
+	}
+	if res.Header().Get("Content-Type") != "application/json; charset=utf-8" || res.Header().Get("Content-Length") != "25" {
+		t.Error("Expected JSON headers got ", res.Header())
+	}
+
+	aRouter.Debug = true
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Body.String() != "{\n  \"name\": \"toon\",\n  \"age\": 34\n}\n" {
+		t.Error("Expected pretty printed JSON got ", res.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/invalid", nil)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusInternalServerError || res.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Error("Expected the error to be returned got ", res.Code, " ", res.Header())
+	}
+}
+
+func TestStreamJSON(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Get("/users", func(res http.ResponseWriter, req *http.Request) {
+		stream := Context(req).StreamJSON(res, http.StatusOK)
+		for _, name := range strings.Split(req.URL.Query().Get("names"), ",") {
+			if name == "" {
+				continue
+			}
+			stream.Encode(jsonUser{Name: name})
+			stream.Flush()
+		}
+		stream.Close()
+	})
+
+	type testPair struct {
+		names string
+		body  string
+	}
+
+	testPairs := []testPair{
+		{"", "[]\n"},
+		{"toon", "[{\"name\":\"toon\",\"age\":0}\n]\n"},
+		{"toon,ket", "[{\"name\":\"toon\",\"age\":0}\n,{\"name\":\"ket\",\"age\":0}\n]\n"},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", "/users?names="+test.names, nil)
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Body.String() != test.body || res.Flushed != (test.names != "") {
+			t.Error("Expected ", test.body, " got ", res.Body.String(), " for ", test.names)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package router
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JWT
+// --------------------------------
+
+// Claims are the claims of a verified JSON Web Token.
+type Claims map[string]interface{}
+
+// Subject returns the "sub" claim.
+func (claims Claims) Subject() string {
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// Scopes returns the scopes from the space separated "scope" claim,
+// or from the "scp" claim when it is a list.
+func (claims Claims) Scopes() []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	if scp, ok := claims["scp"].([]interface{}); ok {
+		scopes := make([]string, 0, len(scp))
+		for _, scope := range scp {
+			if scope, ok := scope.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+// Claims returns the claims of the token verified by the JWT handler,
+// nil when the request has not been authenticated with a token.
+func (cntxt *RequestContext) Claims() Claims {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	return cntxt.claims
+}
+
+// JWTKeySet holds the public keys, or secrets, to verify tokens with.
+type JWTKeySet struct {
+	keys []jwtKey
+}
+
+type jwtKey struct {
+	id  string
+	alg string
+	key interface{}
+}
+
+// NewJWTKeySet creates an empty key set.
+func NewJWTKeySet() *JWTKeySet {
+	return &JWTKeySet{}
+}
+
+// Add adds a key identified by id, matched against the "kid" header of
+// tokens. The key is a []byte secret for HS256, an *rsa.PublicKey for RS256,
+// an *ecdsa.PublicKey on P-256 for ES256 or an ed25519.PublicKey for EdDSA.
+func (set *JWTKeySet) Add(id string, key interface{}) {
+	set.keys = append(set.keys, jwtKey{id: id, key: key})
+}
+
+// LoadJWKS reads a key set from a JSON Web Key Set file.
+func LoadJWKS(path string) (*JWTKeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JSON Web Key Set. Keys of type "oct", "RSA",
+// "EC" on P-256 and "OKP" on Ed25519 are supported, keys not used
+// for signing are skipped.
+func ParseJWKS(data []byte) (*JWTKeySet, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			K   string `json:"k"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("router: invalid JWKS: %v", err)
+	}
+
+	set := NewJWTKeySet()
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key interface{}
+		var err error
+		switch jwk.Kty {
+		case "oct":
+			key, err = decodeSegment(jwk.K)
+		case "RSA":
+			key, err = parseRSAKey(jwk.N, jwk.E)
+		case "EC":
+			key, err = parseECKey(jwk.Crv, jwk.X, jwk.Y)
+		case "OKP":
+			key, err = parseOKPKey(jwk.Crv, jwk.X)
+		default:
+			err = fmt.Errorf("unsupported key type %q", jwk.Kty)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("router: invalid JWKS key %q: %v", jwk.Kid, err)
+		}
+		set.keys = append(set.keys, jwtKey{id: jwk.Kid, alg: jwk.Alg, key: key})
+	}
+	return set, nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := decodeSegment(n)
+	if err != nil {
+		return nil, err
+	}
+	exponent, err := decodeSegment(e)
+	if err != nil {
+		return nil, err
+	}
+	if len(modulus) == 0 || len(exponent) == 0 || len(exponent) > 4 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(modulus),
+		E: int(new(big.Int).SetBytes(exponent).Int64()),
+	}, nil
+}
+
+func parseECKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	if crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xBytes, err := decodeSegment(x)
+	if err != nil {
+		return nil, err
+	}
+	yBytes, err := decodeSegment(y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}
+	if _, err := key.ECDH(); err != nil {
+		return nil, errors.New("point not on curve")
+	}
+	return key, nil
+}
+
+func parseOKPKey(crv, x string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	key, err := decodeSegment(x)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// JWTOptions configures the JWT handler.
+type JWTOptions struct {
+	Keys      *JWTKeySet    // Keys to verify tokens with
+	Issuer    string        // Required "iss" claim, not checked when empty
+	Audience  string        // Required "aud" claim, not checked when empty
+	ClockSkew time.Duration // Leeway when checking "exp" and "nbf"
+	Cookie    string        // Cookie to read the token from when there is no Authorization header
+	Realm     string        // Realm sent to the client, defaults to "Restricted"
+}
+
+// JWT returns a HandlerFunc only letting requests with a valid JSON Web Token
+// through. The token is read from the Authorization header, or from a cookie.
+//
+//	keys, err := router.LoadJWKS("/etc/app/jwks.json")
+//	appRouter.Mount("/api", router.JWT(router.JWTOptions{
+//		Keys:      keys,
+//		Issuer:    "https://auth.example.com",
+//		Audience:  "api",
+//		ClockSkew: 30 * time.Second,
+//	}))
+//
+// Tokens signed with HS256, RS256, ES256 or EdDSA by one of the keys are
+// accepted when they have not expired, are already valid and were issued
+// by Issuer for Audience. Tokens with an "exp", "nbf" or "iat" claim which
+// is not a number are rejected.
+//
+// The claims are stored in the requestContext, use `cntxt.Claims()`. A
+// principal named after the "sub" claim is stored too, so RequireScopes can
+// be used. Requests without a valid token get a 401 generated by the ErrorHandler.
+func JWT(options JWTOptions) http.HandlerFunc {
+	if options.Keys == nil {
+		panic("router: JWT needs Keys to verify tokens with")
+	}
+	if options.Realm == "" {
+		options.Realm = "Restricted"
+	}
+	realm := "Bearer realm=" + strconv.Quote(options.Realm)
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+
+		token, ok := bearerToken(req)
+		if !ok && options.Cookie != "" {
+			if cookie, err := req.Cookie(options.Cookie); err == nil && cookie.Value != "" {
+				token, ok = cookie.Value, true
+			}
+		}
+		if !ok {
+			unauthorized(res, req, realm)
+			return
+		}
+
+		claims, err := verifyJWT(token, options, time.Now())
+		if err != nil {
+			unauthorized(res, req, realm+`, error="invalid_token", error_description=`+strconv.Quote(err.Error()))
+			return
+		}
+
+		cntxt.lock.Lock()
+		cntxt.claims = claims
+		cntxt.principal = &Principal{Name: claims.Subject(), Scopes: claims.Scopes()}
+		cntxt.lock.Unlock()
+		cntxt.Next(res, req)
+	}
+}
+
+// Verifies the token's signature and claims.
+func verifyJWT(token string, options JWTOptions, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJSONSegment(parts[0], &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range options.Keys.keys {
+		if header.Kid != "" && key.id != header.Kid {
+			continue
+		}
+		if key.alg != "" && key.alg != header.Alg {
+			continue
+		}
+		if verifySignature(header.Alg, key.key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.New("invalid signature")
+	}
+
+	var claims Claims
+	if err := decodeJSONSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+
+	// The time claims are NumericDate values, a token with one we can't
+	// read could have expired for all we know
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		if value, ok := claims[name]; ok {
+			if _, ok := value.(float64); !ok {
+				return nil, errors.New("invalid " + name + " claim")
+			}
+		}
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(options.ClockSkew)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(options.ClockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	if options.Issuer != "" && claims["iss"] != options.Issuer {
+		return nil, errors.New("invalid issuer")
+	}
+	if options.Audience != "" && !hasAudience(claims["aud"], options.Audience) {
+		return nil, errors.New("invalid audience")
+	}
+	return claims, nil
+}
+
+// Verifies the signature, only when the key is of the type the algorithm
+// needs. Otherwise a public key could be used as an HMAC secret.
+func verifySignature(alg string, key interface{}, signed, signature []byte) bool {
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case "RS256":
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		hash := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature) == nil
+	case "ES256":
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || publicKey.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		hash := sha256.Sum256(signed)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(publicKey, hash[:], r, s)
+	case "EdDSA":
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false
+		}
+		return ed25519.Verify(publicKey, signed, signature)
+	}
+	return false
+}
+
+// Reports whether the "aud" claim, a string or a list, contains the audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, each := range aud {
+			if each == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+}
+
+func decodeJSONSegment(segment string, v interface{}) error {
+	data, err := decodeSegment(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,241 @@
+package router
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyJWT(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+
+	keys := NewJWTKeySet()
+	keys.Add("hmac", secret)
+	keys.Add("rsa", &rsaKey.PublicKey)
+	keys.Add("ec", &ecKey.PublicKey)
+	keys.Add("ed", edPublic)
+
+	options := JWTOptions{Keys: keys, Issuer: "auth", Audience: "api", ClockSkew: time.Minute}
+	now := time.Now()
+	valid := Claims{"sub": "richard", "iss": "auth", "aud": "api", "exp": now.Add(time.Hour).Unix()}
+
+	with := func(changes Claims) Claims {
+		claims := Claims{}
+		for name, value := range valid {
+			claims[name] = value
+		}
+		for name, value := range changes {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	type testPair struct {
+		name     string
+		token    string
+		expected string
+	}
+
+	testPairs := []testPair{
+		{"HS256", signJWT("HS256", "hmac", secret, valid), ""},
+		{"RS256", signJWT("RS256", "rsa", rsaKey, valid), ""},
+		{"ES256", signJWT("ES256", "ec", ecKey, valid), ""},
+		{"EdDSA", signJWT("EdDSA", "ed", edPrivate, valid), ""},
+		{"without kid", signJWT("HS256", "", secret, valid), ""},
+		{"audience list", signJWT("HS256", "hmac", secret, with(Claims{"aud": []string{"web", "api"}})), ""},
+		{"expired within skew", signJWT("HS256", "hmac", secret, with(Claims{"exp": now.Add(-30 * time.Second).Unix()})), ""},
+		{"expired", signJWT("HS256", "hmac", secret, with(Claims{"exp": now.Add(-2 * time.Minute).Unix()})), "token expired"},
+		{"not valid yet", signJWT("HS256", "hmac", secret, with(Claims{"nbf": now.Add(2 * time.Minute).Unix()})), "token not valid yet"},
+		{"expiry as string", signJWT("HS256", "hmac", secret, with(Claims{"exp": "1"})), "invalid exp claim"},
+		{"nbf as string", signJWT("HS256", "hmac", secret, with(Claims{"nbf": "1"})), "invalid nbf claim"},
+		{"iat as null", signJWT("HS256", "hmac", secret, with(Claims{"iat": nil})), "invalid iat claim"},
+		{"wrong issuer", signJWT("HS256", "hmac", secret, with(Claims{"iss": "other"})), "invalid issuer"},
+		{"wrong audience", signJWT("HS256", "hmac", secret, with(Claims{"aud": "web"})), "invalid audience"},
+		{"wrong secret", signJWT("HS256", "hmac", []byte("other"), valid), "invalid signature"},
+		{"wrong kid", signJWT("RS256", "ec", rsaKey, valid), "invalid signature"},
+		{"none", signJWT("none", "", nil, valid), "invalid signature"},
+		{"malformed", "not.a-token", "malformed token"},
+	}
+
+	for _, test := range testPairs {
+		_, err := verifyJWT(test.token, options, now)
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+		if message != test.expected {
+			t.Error("Expected ", test.expected, " got ", message, " for ", test.name)
+		}
+	}
+}
+
+func TestVerifyJWTAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys := NewJWTKeySet()
+	keys.Add("rsa", &rsaKey.PublicKey)
+
+	// Signing with the public key as HMAC secret must not work
+	publicKey := rsaKey.PublicKey.N.Bytes()
+	token := signJWT("HS256", "rsa", publicKey, Claims{"sub": "richard"})
+
+	if _, err := verifyJWT(token, JWTOptions{Keys: keys}, time.Now()); err == nil {
+		t.Error("Expected a token signed with the public key to be rejected")
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	encode := base64.RawURLEncoding.EncodeToString
+
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hmac", "alg": "HS256", "k": %q},
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`,
+		encode([]byte("secret")),
+		encode(rsaKey.N.Bytes()), encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+		encode(ecKey.X.FillBytes(make([]byte, 32))), encode(ecKey.Y.FillBytes(make([]byte, 32))),
+		encode(edPublic),
+	)
+
+	keys, err := ParseJWKS([]byte(jwks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.keys) != 4 {
+		t.Error("Expected the encryption key to be skipped got ", len(keys.keys), " keys")
+	}
+
+	options := JWTOptions{Keys: keys}
+	claims := Claims{"sub": "richard"}
+	tokens := []string{
+		signJWT("HS256", "hmac", []byte("secret"), claims),
+		signJWT("RS256", "rsa", rsaKey, claims),
+		signJWT("ES256", "ec", ecKey, claims),
+		signJWT("EdDSA", "ed", edPrivate, claims),
+	}
+	for _, token := range tokens {
+		if _, err := verifyJWT(token, options, time.Now()); err != nil {
+			t.Error("Expected the token to be verified got ", err)
+		}
+	}
+
+	if _, err := ParseJWKS([]byte(`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`)); err == nil {
+		t.Error("Expected an invalid point to be rejected")
+	}
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("secret")
+	keys := NewJWTKeySet()
+	keys.Add("", secret)
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", JWT(JWTOptions{Keys: keys, Cookie: "token"}))
+	aRouter.Get("/", RequireScopes("users:read"), func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		res.Write([]byte(cntxt.Principal().Name + " " + cntxt.Claims()["name"].(string)))
+	})
+
+	token := signJWT("HS256", "", secret, Claims{"sub": "14", "name": "richard", "scope": "users:read users:write"})
+
+	// From the Authorization header
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK || res.Body.String() != "14 richard" {
+		t.Error("Expected the claims to be stored got ", res.Code, res.Body.String())
+	}
+
+	// From a cookie
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Error("Expected the token to be read from the cookie got ", res.Code)
+	}
+
+	// Missing
+	req, _ = http.NewRequest("GET", "/", nil)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnauthorized || res.Header().Get("WWW-Authenticate") != `Bearer realm="Restricted"` {
+		t.Error("Expected a 401 with a challenge got ", res.Code, res.Header())
+	}
+
+	// Invalid
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnauthorized || !strings.Contains(res.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+		t.Error("Expected a 401 for an invalid token got ", res.Code, res.Header())
+	}
+
+	// Lacking a scope
+	token = signJWT("HS256", "", secret, Claims{"sub": "14", "name": "richard", "scp": []string{"users:write"}})
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Code != http.StatusForbidden {
+		t.Error("Expected a 403 got ", res.Code)
+	}
+}
+
+// Creates a token signed with the private key for the algorithm.
+func signJWT(alg, kid string, key interface{}, claims Claims) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	encode := base64.RawURLEncoding.EncodeToString
+	signed := encode(headerJSON) + "." + encode(claimsJSON)
+
+	hash := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, key, hash[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(signed))
+	}
+	return signed + "." + encode(signature)
+}
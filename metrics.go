@@ -0,0 +1,250 @@
+package router
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics
+// --------------------------------
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the
+// request duration histogram.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the upper bounds, in bytes, of the
+// response size histogram.
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// MetricsOptions configures the metrics.
+type MetricsOptions struct {
+	Namespace       string    // Prefix of the metric names, defaults to "http"
+	DurationBuckets []float64 // Defaults to DefaultDurationBuckets
+	SizeBuckets     []float64 // Defaults to DefaultSizeBuckets
+}
+
+// Metrics collects request metrics and exposes them in the
+// Prometheus text format.
+//
+//	metrics := router.NewMetrics(router.MetricsOptions{})
+//	appRouter.Mount("/", metrics.Handler())
+//	appRouter.Get("/metrics", metrics.ServeHTTP)
+//
+// Requests are counted, and their duration and response size recorded,
+// by method, route and status class like "2xx". The number of requests
+// being handled is kept by method and route. Using the route as
+// registered, not the actual path, keeps the number of series bounded.
+type Metrics struct {
+	options  MetricsOptions
+	lock     sync.Mutex
+	series   map[metricLabels]*metricSeries
+	inFlight map[metricLabels]int64
+}
+
+type metricLabels struct {
+	method string
+	route  string
+	status string
+}
+
+type metricSeries struct {
+	requests uint64
+	duration histogram
+	size     histogram
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, the last one for values above all bounds
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(bounds []float64, value float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds)+1)
+	}
+	h.counts[sort.SearchFloat64s(bounds, value)]++
+	h.sum += value
+	h.count++
+}
+
+// NewMetrics creates a metrics collector.
+func NewMetrics(options MetricsOptions) *Metrics {
+	if options.Namespace == "" {
+		options.Namespace = "http"
+	}
+	if options.DurationBuckets == nil {
+		options.DurationBuckets = DefaultDurationBuckets
+	}
+	if options.SizeBuckets == nil {
+		options.SizeBuckets = DefaultSizeBuckets
+	}
+	options.DurationBuckets = sortedBuckets(options.DurationBuckets)
+	options.SizeBuckets = sortedBuckets(options.SizeBuckets)
+
+	return &Metrics{
+		options:  options,
+		series:   make(map[metricLabels]*metricSeries),
+		inFlight: make(map[metricLabels]int64),
+	}
+}
+
+// Handler returns a HandlerFunc recording the metrics of requests.
+// Mount it so it applies to all routes.
+func (metrics *Metrics) Handler() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		cntxt := Context(req)
+		flight := metricLabels{method: req.Method, route: cntxt.Route()}
+
+		metrics.lock.Lock()
+		metrics.inFlight[flight]++
+		metrics.lock.Unlock()
+		defer func() {
+			metrics.lock.Lock()
+			metrics.inFlight[flight]--
+			metrics.lock.Unlock()
+		}()
+
+		cntxt.Next(res, req)
+
+		duration := time.Since(start)
+		status := cntxt.Response().Status()
+		if status == 0 {
+			// Nothing has been written, go will respond with a 200
+			status = http.StatusOK
+		}
+		labels := metricLabels{method: req.Method, route: flight.route, status: strconv.Itoa(status/100) + "xx"}
+
+		metrics.lock.Lock()
+		defer metrics.lock.Unlock()
+		series, ok := metrics.series[labels]
+		if !ok {
+			series = new(metricSeries)
+			metrics.series[labels] = series
+		}
+		series.requests++
+		series.duration.observe(metrics.options.DurationBuckets, duration.Seconds())
+		series.size.observe(metrics.options.SizeBuckets, float64(cntxt.Response().Size()))
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (metrics *Metrics) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	// Don't keep requests from being recorded while writing to a slow client
+	var w bytes.Buffer
+	defer func() {
+		res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		res.Write(w.Bytes())
+	}()
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	ns := metrics.options.Namespace
+	keys := make([]metricLabels, 0, len(metrics.series))
+	for labels := range metrics.series {
+		keys = append(keys, labels)
+	}
+	sortMetricLabels(keys)
+
+	writeMetricHeader(&w, ns+"_requests_total", "counter", "Number of requests handled.")
+	for _, labels := range keys {
+		writeMetric(&w, ns+"_requests_total", labels.String(), float64(metrics.series[labels].requests))
+	}
+
+	writeMetricHeader(&w, ns+"_request_duration_seconds", "histogram", "Time taken to handle requests.")
+	for _, labels := range keys {
+		writeHistogram(&w, ns+"_request_duration_seconds", labels.String(), metrics.options.DurationBuckets, &metrics.series[labels].duration)
+	}
+
+	writeMetricHeader(&w, ns+"_response_size_bytes", "histogram", "Size of response bodies.")
+	for _, labels := range keys {
+		writeHistogram(&w, ns+"_response_size_bytes", labels.String(), metrics.options.SizeBuckets, &metrics.series[labels].size)
+	}
+
+	flights := make([]metricLabels, 0, len(metrics.inFlight))
+	for labels := range metrics.inFlight {
+		flights = append(flights, labels)
+	}
+	sortMetricLabels(flights)
+
+	writeMetricHeader(&w, ns+"_requests_in_flight", "gauge", "Number of requests being handled.")
+	for _, labels := range flights {
+		writeMetric(&w, ns+"_requests_in_flight", labels.String(), float64(metrics.inFlight[labels]))
+	}
+}
+
+// Formats the labels, leaving out the status when empty.
+func (labels metricLabels) String() string {
+	s := `method="` + escapeLabelValue(labels.method) + `",route="` + escapeLabelValue(labels.route) + `"`
+	if labels.status != "" {
+		s += `,status="` + labels.status + `"`
+	}
+	return s
+}
+
+// Returns a sorted copy of the bucket bounds.
+func sortedBuckets(bounds []float64) []float64 {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return bounds
+}
+
+func sortMetricLabels(keys []metricLabels) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+}
+
+func writeMetricHeader(w *bytes.Buffer, name, kind, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func writeMetric(w *bytes.Buffer, name, labels string, value float64) {
+	w.WriteString(name + "{" + labels + "} " + formatMetricValue(value) + "\n")
+}
+
+func writeHistogram(w *bytes.Buffer, name, labels string, bounds []float64, h *histogram) {
+	var cumulative uint64
+	for i, bound := range bounds {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		writeMetric(w, name+"_bucket", labels+`,le="`+formatMetricValue(bound)+`"`, float64(cumulative))
+	}
+	writeMetric(w, name+"_bucket", labels+`,le="+Inf"`, float64(h.count))
+	writeMetric(w, name+"_sum", labels, h.sum)
+	writeMetric(w, name+"_count", labels, float64(h.count))
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Escapes backslashes, double quotes and line feeds as
+// the exposition format requires.
+func escapeLabelValue(value string) string {
+	if !strings.ContainsAny(value, "\\\"\n") {
+		return value
+	}
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
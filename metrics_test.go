@@ -0,0 +1,70 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(MetricsOptions{
+		DurationBuckets: []float64{10, 1},
+		SizeBuckets:     []float64{5, 100},
+	})
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", metrics.Handler())
+	aRouter.Get("/user/:userid", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("richard"))
+	})
+	aRouter.Get("/fail", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Error(res, req, "oops", http.StatusInternalServerError)
+	})
+	aRouter.Get("/metrics", metrics.ServeHTTP)
+
+	for _, path := range []string{"/user/1", "/user/2", "/fail"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		aRouter.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Header().Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Error("Expected the exposition format got ", res.Header().Get("Content-Type"))
+	}
+
+	body := res.Body.String()
+	expected := []string{
+		"# TYPE http_requests_total counter\n",
+		`http_requests_total{method="GET",route="/user/:userid",status="2xx"} 2` + "\n",
+		`http_requests_total{method="GET",route="/fail",status="5xx"} 1` + "\n",
+		"# TYPE http_request_duration_seconds histogram\n",
+		`http_request_duration_seconds_bucket{method="GET",route="/user/:userid",status="2xx",le="1"} 2` + "\n",
+		`http_request_duration_seconds_bucket{method="GET",route="/user/:userid",status="2xx",le="10"} 2` + "\n",
+		`http_request_duration_seconds_bucket{method="GET",route="/user/:userid",status="2xx",le="+Inf"} 2` + "\n",
+		`http_request_duration_seconds_count{method="GET",route="/user/:userid",status="2xx"} 2` + "\n",
+		`http_response_size_bytes_bucket{method="GET",route="/user/:userid",status="2xx",le="5"} 0` + "\n",
+		`http_response_size_bytes_bucket{method="GET",route="/user/:userid",status="2xx",le="100"} 2` + "\n",
+		`http_response_size_bytes_sum{method="GET",route="/user/:userid",status="2xx"} 14` + "\n",
+		"# TYPE http_requests_in_flight gauge\n",
+		`http_requests_in_flight{method="GET",route="/user/:userid"} 0` + "\n",
+		`http_requests_in_flight{method="GET",route="/metrics"} 1` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Error("Expected the metrics to contain ", line, " got\n", body)
+		}
+	}
+	if strings.Contains(body, "/user/1") {
+		t.Error("Expected metrics by route, not by path")
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if escaped := escapeLabelValue("a\"b\\c\nd"); escaped != `a\"b\\c\nd` {
+		t.Error("Expected the value to be escaped got ", escaped)
+	}
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Params
+// --------------------------------
+
+// Param is a single route param, the name of the token in the route
+// path (without ":") and the value it matched.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Params holds route params in the order their tokens appear in the route
+// path, so `range` over them iterates in path order. Names can repeat.
+// Get them with `cntxt.RouteParams()`.
+//
+// It is a plain slice so the router can reuse it between requests
+// without allocating.
+type Params []Param
+
+// Get returns the value of the param with the given name or an
+// empty string if there is no such param. When the name is repeated,
+// the first value is returned.
+func (params Params) Get(name string) string {
+	for _, param := range params {
+		if param.Name == name {
+			return param.Value
+		}
+	}
+	return ""
+}
+
+// Lookup returns the value of the param with the given name and whether
+// it was found at all, so empty values can be told apart from missing ones.
+func (params Params) Lookup(name string) (string, bool) {
+	for _, param := range params {
+		if param.Name == name {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByIndex returns the value of the i-th param in the order the tokens
+// appear in the route path or an empty string if there is no such param.
+func (params Params) ByIndex(i int) string {
+	if i < 0 || i >= len(params) {
+		return ""
+	}
+	return params[i].Value
+}
+
+// Values returns all values for the given name in the order they appear
+// in the route path. Use it for paths which repeat a token, like
+// "/compare/:id/with/:id".
+func (params Params) Values(name string) (values []string) {
+	for _, param := range params {
+		if param.Name == name {
+			values = append(values, param.Value)
+		}
+	}
+	return
+}
+
+// Map returns the params as a map, the way `cntxt.Params` holds them.
+// When a name is repeated, the first value wins just like with Get.
+func (params Params) Map() map[string]string {
+	withParams := make(map[string]string, len(params))
+	params.fill(withParams)
+	return withParams
+}
+
+// Adds the params to the map, the first value winning.
+func (params Params) fill(withParams map[string]string) {
+	for i := len(params) - 1; i >= 0; i-- {
+		withParams[params[i].Name] = params[i].Value
+	}
+}
+
+// BuildPath generates a path for a route path containing tokens
+// like "/user/:userid" by filling in the given params.
+//
+// Tokens are filled in the order they appear, so a path repeating a token
+// gets the values in the same order as they were matched. Values are
+// escaped. An error is returned when a token has no value to fill in.
+func BuildPath(path string, params Params) (string, error) {
+	parts := strings.Split(path, "/")
+	used := make(map[string]int)
+	for i, part := range parts {
+		if !strings.HasPrefix(part, ":") {
+			continue
+		}
+		nameOnly := strings.Trim(part, ":")
+		values := params.Values(nameOnly)
+		if used[nameOnly] >= len(values) {
+			return "", fmt.Errorf("router: no value for param %q in path %q", nameOnly, path)
+		}
+		parts[i] = url.PathEscape(values[used[nameOnly]])
+		used[nameOnly]++
+	}
+	return strings.Join(parts, "/"), nil
+}
@@ -0,0 +1,146 @@
+package router
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParamsGet(t *testing.T) {
+	params := Params{{"userid", "14"}, {"name", "richard"}}
+
+	if val := params.Get("userid"); val != "14" {
+		t.Error("Expected 14 got ", val)
+	}
+	if val := params.Get("name"); val != "richard" {
+		t.Error("Expected richard got ", val)
+	}
+	if val := params.Get("doesNotExist"); val != "" {
+		t.Error("Expected an empty string got ", val)
+	}
+	if val := Params(nil).Get("userid"); val != "" {
+		t.Error("Expected an empty string got ", val)
+	}
+}
+
+func TestParamsOrderAndDuplicates(t *testing.T) {
+	aRouter := NewRouter()
+	handler := func(res http.ResponseWriter, req *http.Request) {}
+	reqHandler := aRouter.makeRequestHandler("/compare/:id/with/:id/by/:field", handler)
+
+	isAMatch, params := reqHandler.matches("/compare/1/with/2/by/name", nil)
+	if !isAMatch {
+		t.Fatal("Expected the path to match")
+	}
+
+	expected := Params{{"id", "1"}, {"id", "2"}, {"field", "name"}}
+	if !reflect.DeepEqual(expected, params) {
+		t.Error("Expected ", expected, " got ", params)
+	}
+
+	if val := params.Get("id"); val != "1" {
+		t.Error("Get should return the first value, got ", val)
+	}
+	if vals := params.Values("id"); !reflect.DeepEqual(vals, []string{"1", "2"}) {
+		t.Error("Expected [1 2] got ", vals)
+	}
+	if val := params.ByIndex(1); val != "2" {
+		t.Error("Expected 2 got ", val)
+	}
+	if val := params.ByIndex(3); val != "" {
+		t.Error("Expected an empty string for an index out of range got ", val)
+	}
+	if val, ok := params.Lookup("field"); !ok || val != "name" {
+		t.Error("Expected name got ", val)
+	}
+	if _, ok := params.Lookup("doesNotExist"); ok {
+		t.Error("Lookup should report missing params")
+	}
+	if m := params.Map(); !reflect.DeepEqual(m, map[string]string{"id": "1", "field": "name"}) {
+		t.Error("Expected map with the first values got ", m)
+	}
+
+	var names []string
+	for _, param := range params {
+		names = append(names, param.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"id", "id", "field"}) {
+		t.Error("Params should iterate in path order, got ", names)
+	}
+}
+
+func TestBuildPath(t *testing.T) {
+
+	type testPair struct {
+		path     string
+		params   Params
+		expected string
+	}
+
+	testPairs := []testPair{
+		{"/hello", nil, "/hello"},
+		{"/user/:userid", Params{{"userid", "14"}}, "/user/14"},
+		{"/user/:userid/hello", Params{{"userid", "richard p"}}, "/user/richard%20p/hello"},
+		{"/compare/:id/with/:id", Params{{"id", "1"}, {"id", "2"}}, "/compare/1/with/2"},
+		{"/:a/:b", Params{{"b", "2"}, {"a", "1"}}, "/1/2"},
+	}
+
+	for _, test := range testPairs {
+		path, err := BuildPath(test.path, test.params)
+		if err != nil || path != test.expected {
+			t.Error("Expected ", test.expected, " got ", path, err)
+		}
+	}
+
+	// Paths we build should be matched with the same params
+	aRouter := NewRouter()
+	reqHandler := aRouter.makeRequestHandler("/compare/:id/with/:id", func(res http.ResponseWriter, req *http.Request) {})
+	params := Params{{"id", "1"}, {"id", "2"}}
+	path, _ := BuildPath(reqHandler.Path, params)
+	if _, withParams := reqHandler.matches(path, nil); !reflect.DeepEqual(params, withParams) {
+		t.Error("Expected ", params, " got ", withParams)
+	}
+
+	if _, err := BuildPath("/compare/:id/with/:id", Params{{"id", "1"}}); err == nil {
+		t.Error("Expected an error for a missing param")
+	}
+}
+
+// The map keeps working for existing handlers, the ordered
+// params are there for those which need them.
+func TestContextParams(t *testing.T) {
+	var params map[string]string
+	var routeParams Params
+	aRouter := NewRouter()
+	handler := func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		params, routeParams = maps.Clone(cntxt.Params), append(Params(nil), cntxt.RouteParams()...)
+	}
+	aRouter.Get("/compare/:id/with/:id", handler)
+	aRouter.Get("/static", func(res http.ResponseWriter, req *http.Request) {
+		handler(res, req)
+		// Handlers can add params of their own
+		Context(req).Params["set"] = "by handler"
+	})
+
+	req, _ := http.NewRequest("GET", "/compare/1/with/2", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !reflect.DeepEqual(params, map[string]string{"id": "1"}) {
+		t.Error("Expected the first value by name got ", params)
+	}
+	if !reflect.DeepEqual(routeParams, Params{{"id", "1"}, {"id", "2"}}) {
+		t.Error("Expected the params in path order got ", routeParams)
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ = http.NewRequest("GET", "/static", nil)
+		aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+		if params == nil || len(params) != 0 || len(routeParams) != 0 {
+			t.Error("Expected empty params for a static route got ", params, routeParams)
+		}
+	}
+}
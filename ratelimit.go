@@ -0,0 +1,281 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit
+// --------------------------------
+
+// RateLimitResult is the outcome of taking a request into account
+// for a rate limit.
+type RateLimitResult struct {
+	Allowed    bool          // Whether the request may proceed
+	Limit      int           // Number of requests allowed per window
+	Remaining  int           // Number of requests left
+	Reset      time.Duration // Time until the full limit is available again
+	RetryAfter time.Duration // Time until the next request is allowed, when not allowed
+}
+
+// RateLimitStore keeps track of the requests made for each key.
+//
+// Implement it to share rate limits between servers, using an
+// external backend like Redis.
+type RateLimitStore interface {
+	// Take counts a request for the key, allowing at most limit
+	// requests per window.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// RateLimitAlgorithm selects how the memory store limits requests.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts of up to the limit, refilling the
+	// bucket evenly over the window.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows the limit in any window, approximated by
+	// weighing the count of the previous window.
+	SlidingWindow
+)
+
+// MemoryRateLimitStore is a RateLimitStore keeping track of requests in
+// memory. Use it when all requests are handled by a single server.
+type MemoryRateLimitStore struct {
+	algorithm RateLimitAlgorithm
+	lock      sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// State kept for each key.
+type rateLimitEntry struct {
+	tokens      float64       // TokenBucket: tokens left
+	count       int           // SlidingWindow: requests in the current window
+	prevCount   int           // SlidingWindow: requests in the previous window
+	windowStart time.Time     // SlidingWindow: start of the current window, TokenBucket: last refill
+	window      time.Duration // Window of the limiter using the key
+	updated     time.Time
+}
+
+// NewMemoryRateLimitStore creates an in memory store
+// using the given algorithm.
+func NewMemoryRateLimitStore(algorithm RateLimitAlgorithm) *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		algorithm: algorithm,
+		entries:   make(map[string]*rateLimitEntry),
+		now:       time.Now,
+	}
+}
+
+// Take counts a request for the key.
+func (store *MemoryRateLimitStore) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	now := store.now()
+	store.sweep(now, window)
+
+	entry, ok := store.entries[key]
+	if !ok {
+		entry = &rateLimitEntry{tokens: float64(limit), windowStart: now}
+		store.entries[key] = entry
+	}
+	entry.window = window
+	entry.updated = now
+
+	if store.algorithm == SlidingWindow {
+		return entry.takeSlidingWindow(now, limit, window), nil
+	}
+	return entry.takeTokenBucket(now, limit, window), nil
+}
+
+// Removes the entries which have not been used for two of their windows,
+// those are back at their full limit anyway. Limiters sharing the store
+// can use different windows, so each entry expires by its own.
+func (store *MemoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(store.lastSweep) < window {
+		return
+	}
+	store.lastSweep = now
+	for key, entry := range store.entries {
+		if now.Sub(entry.updated) >= 2*entry.window {
+			delete(store.entries, key)
+		}
+	}
+}
+
+func (entry *rateLimitEntry) takeTokenBucket(now time.Time, limit int, window time.Duration) (result RateLimitResult) {
+	// Refill the bucket for the time passed
+	perToken := window / time.Duration(limit)
+	elapsed := now.Sub(entry.windowStart)
+	entry.tokens = math.Min(float64(limit), entry.tokens+float64(elapsed)/float64(perToken))
+	entry.windowStart = now
+
+	result.Limit = limit
+	if entry.tokens >= 1 {
+		entry.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - entry.tokens) * float64(perToken))
+	}
+	result.Remaining = int(entry.tokens)
+	result.Reset = time.Duration((float64(limit) - entry.tokens) * float64(perToken))
+	return
+}
+
+func (entry *rateLimitEntry) takeSlidingWindow(now time.Time, limit int, window time.Duration) (result RateLimitResult) {
+	// Move the window along
+	if elapsed := now.Sub(entry.windowStart); elapsed >= window {
+		if elapsed >= 2*window {
+			entry.prevCount = 0
+		} else {
+			entry.prevCount = entry.count
+		}
+		entry.count = 0
+		entry.windowStart = entry.windowStart.Add(elapsed / window * window)
+	}
+
+	elapsed := now.Sub(entry.windowStart)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(entry.prevCount)*weight + float64(entry.count)
+
+	result.Limit = limit
+	if estimate+1 <= float64(limit) {
+		entry.count++
+		estimate++
+		result.Allowed = true
+	} else {
+		// Wait for the previous window to weigh less, or for
+		// the current one to become the previous one.
+		retryAfter := window - elapsed
+		if entry.prevCount > 0 && entry.count < limit {
+			needed := 1 - (float64(limit)-1-float64(entry.count))/float64(entry.prevCount)
+			retryAfter = time.Duration(needed*float64(window)) - elapsed
+		}
+		if retryAfter < 0 {
+			retryAfter = 0
+		}
+		result.RetryAfter = retryAfter
+	}
+	result.Remaining = int(math.Max(0, float64(limit)-estimate))
+	result.Reset = window - elapsed
+	return
+}
+
+// RateLimitKeyFunc returns the key to limit the request by. Requests
+// for which it returns an empty string are not limited.
+type RateLimitKeyFunc func(req *http.Request) string
+
+// KeyByIP limits requests by the client's IP address as found in
+// req.RemoteAddr. Behind a proxy, use a RateLimitKeyFunc reading the
+// address from the header it sets instead.
+func KeyByIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// KeyByContextValue limits requests by a value stored in the
+// requestContext, like the user set by a previous handler.
+func KeyByContextValue(key interface{}) RateLimitKeyFunc {
+	return func(req *http.Request) string {
+		if val, ok := Context(req).Get(key); ok && val != nil {
+			return fmt.Sprint(val)
+		}
+		return ""
+	}
+}
+
+// KeyByParam limits requests by the value of a route param.
+func KeyByParam(name string) RateLimitKeyFunc {
+	return func(req *http.Request) string {
+		return Context(req).params.Get(name)
+	}
+}
+
+// RateLimitOptions configures the RateLimit handler.
+type RateLimitOptions struct {
+	Limit  int              // Number of requests allowed per window
+	Window time.Duration    // Window the limit applies to
+	Key    RateLimitKeyFunc // What to limit requests by, defaults to KeyByIP
+	Store  RateLimitStore   // Where to keep track of requests, defaults to a memory store using TokenBucket
+	Name   string           // Prefix for the keys in the store, so limiters can share a store
+}
+
+// RateLimit returns a HandlerFunc limiting the number of requests. Mount
+// it to limit all requests or register it on a route to limit just that.
+//
+//	appRouter.Mount("/api", router.RateLimit(router.RateLimitOptions{
+//		Limit:  100,
+//		Window: time.Minute,
+//	}))
+//
+//	appRouter.Post("/user/:userid/messages", loadUser, router.RateLimit(router.RateLimitOptions{
+//		Limit:  10,
+//		Window: time.Minute,
+//		Key:    router.KeyByContextValue("user"),
+//		Name:   "messages",
+//	}), postMessage)
+//
+// Responses carry the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset
+// and RateLimit-Policy headers. When the limit is hit, the ErrorHandler
+// responds with a 429 and a Retry-After header is set.
+//
+// When the store fails, requests are let through.
+func RateLimit(options RateLimitOptions) http.HandlerFunc {
+	if options.Limit < 1 || options.Window <= 0 {
+		panic("router: RateLimit needs a Limit of at least 1 and a Window")
+	}
+	if options.Key == nil {
+		options.Key = KeyByIP
+	}
+	if options.Store == nil {
+		options.Store = NewMemoryRateLimitStore(TokenBucket)
+	}
+	policy := fmt.Sprintf("%d;w=%d", options.Limit, int(options.Window/time.Second))
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+
+		key := options.Key(req)
+		if key == "" {
+			cntxt.Next(res, req)
+			return
+		}
+
+		result, err := options.Store.Take(req.Context(), options.Name+":"+key, options.Limit, options.Window)
+		if err != nil {
+			cntxt.Next(res, req)
+			return
+		}
+
+		header := res.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		header.Set("RateLimit-Policy", policy)
+
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			cntxt.Error(res, req, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		cntxt.Next(res, req)
+	}
+}
+
+// Rounds the duration up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
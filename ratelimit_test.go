@@ -0,0 +1,205 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryRateLimitStore(TokenBucket)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// A burst up to the limit is allowed
+	for i := 0; i < 5; i++ {
+		result, _ := store.Take(ctx, "key", 5, 10*time.Second)
+		if !result.Allowed || result.Remaining != 4-i {
+			t.Error("Expected request ", i, " to be allowed got ", result)
+		}
+	}
+
+	result, _ := store.Take(ctx, "key", 5, 10*time.Second)
+	if result.Allowed || result.RetryAfter != 2*time.Second || result.Reset != 10*time.Second {
+		t.Error("Expected the request to be limited for 2 seconds got ", result)
+	}
+
+	// Other keys have their own bucket
+	if result, _ := store.Take(ctx, "other", 5, 10*time.Second); !result.Allowed {
+		t.Error("Expected another key to be allowed")
+	}
+
+	// A token is added every 2 seconds
+	now = now.Add(2 * time.Second)
+	if result, _ := store.Take(ctx, "key", 5, 10*time.Second); !result.Allowed || result.Remaining != 0 {
+		t.Error("Expected a refilled token to be used got ", result)
+	}
+	if result, _ := store.Take(ctx, "key", 5, 10*time.Second); result.Allowed {
+		t.Error("Expected the request to be limited got ", result)
+	}
+
+	// Idle keys are cleaned up
+	now = now.Add(time.Minute)
+	store.Take(ctx, "new", 5, 10*time.Second)
+	if len(store.entries) != 1 {
+		t.Error("Expected idle keys to be removed, got ", len(store.entries), " entries")
+	}
+
+	// Keys of limiters with a longer window are kept for longer
+	store.Take(ctx, "hourly", 5, time.Hour)
+	now = now.Add(time.Minute)
+	store.Take(ctx, "new", 5, 10*time.Second)
+	if _, ok := store.entries["hourly"]; !ok {
+		t.Error("Expected the key with a longer window to be kept")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryRateLimitStore(SlidingWindow)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if result, _ := store.Take(ctx, "key", 4, 10*time.Second); !result.Allowed {
+			t.Error("Expected request ", i, " to be allowed got ", result)
+		}
+	}
+	result, _ := store.Take(ctx, "key", 4, 10*time.Second)
+	if result.Allowed || result.RetryAfter != 10*time.Second {
+		t.Error("Expected the request to be limited until the window ends got ", result)
+	}
+
+	// Halfway the next window, the previous one weighs half
+	now = now.Add(15 * time.Second)
+	for i := 0; i < 2; i++ {
+		if result, _ := store.Take(ctx, "key", 4, 10*time.Second); !result.Allowed {
+			t.Error("Expected request ", i, " to be allowed got ", result)
+		}
+	}
+	result, _ = store.Take(ctx, "key", 4, 10*time.Second)
+	if result.Allowed || result.Remaining != 0 || result.RetryAfter != 2500*time.Millisecond {
+		t.Error("Expected the request to be limited got ", result)
+	}
+
+	// After two windows, everything is forgotten
+	now = now.Add(20 * time.Second)
+	if result, _ := store.Take(ctx, "key", 4, 10*time.Second); !result.Allowed || result.Remaining != 3 {
+		t.Error("Expected a fresh window got ", result)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err string, code int) {
+		http.Error(res, "slow down: "+err, code)
+	}
+	aRouter.Mount("/", RateLimit(RateLimitOptions{Limit: 2, Window: time.Minute}))
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("ok"))
+	})
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Header().Get("RateLimit-Limit") != "2" ||
+			res.Header().Get("RateLimit-Policy") != "2;w=60" {
+			t.Error("Expected the rate limit headers got ", res.Header())
+		}
+
+		if i < 2 && (res.Code != 200 || res.Body.String() != "ok") {
+			t.Error("Expected request ", i, " to be allowed got ", res.Code)
+		}
+		if i == 2 && (res.Code != http.StatusTooManyRequests ||
+			res.Body.String() != "slow down: Too Many Requests\n" ||
+			res.Header().Get("Retry-After") != "30" ||
+			res.Header().Get("RateLimit-Remaining") != "0") {
+			t.Error("Expected the request to be limited got ", res.Code, res.Header(), res.Body.String())
+		}
+	}
+
+	// Other clients are not limited
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+	if res.Code != 200 {
+		t.Error("Expected another client to be allowed got ", res.Code)
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	aRouter := NewRouter()
+	store := NewMemoryRateLimitStore(TokenBucket)
+
+	loadUser := func(res http.ResponseWriter, req *http.Request) {
+		if user := req.Header.Get("X-User"); user != "" {
+			Context(req).Set("user", user)
+		}
+		Context(req).Next(res, req)
+	}
+	handler := func(res http.ResponseWriter, req *http.Request) {}
+
+	aRouter.Post("/messages", loadUser, RateLimit(RateLimitOptions{
+		Limit: 1, Window: time.Minute, Key: KeyByContextValue("user"), Store: store, Name: "messages",
+	}), handler)
+	aRouter.Get("/user/:userid", RateLimit(RateLimitOptions{
+		Limit: 1, Window: time.Minute, Key: KeyByParam("userid"), Store: store, Name: "users",
+	}), handler)
+
+	type testPair struct {
+		method, path, user string
+		expected           int
+	}
+
+	testPairs := []testPair{
+		{"POST", "/messages", "richard", 200},
+		{"POST", "/messages", "richard", 429},
+		{"POST", "/messages", "ada", 200},
+		{"POST", "/messages", "", 200},
+		{"POST", "/messages", "", 200},
+		{"GET", "/user/richard", "", 200},
+		{"GET", "/user/richard", "", 429},
+		{"GET", "/user/ada", "", 200},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		req.Header.Set("X-User", test.user)
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.expected {
+			t.Error("Expected ", test.expected, " got ", res.Code, " for ", test.method, test.path, test.user)
+		}
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (store failingRateLimitStore) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("unavailable")
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Get("/", RateLimit(RateLimitOptions{Limit: 1, Window: time.Second, Store: failingRateLimitStore{}}),
+		func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("ok"))
+		})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Body.String() != "ok" {
+		t.Error("Expected the request to be let through when the store fails got ", res.Code)
+	}
+}
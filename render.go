@@ -0,0 +1,274 @@
+package router
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Rendering
+// --------------------------------
+
+// Renderer renders values in a format clients can ask for. Implement it
+// to respond in formats like MessagePack or protobuf.
+type Renderer interface {
+	// ContentType returns the Content-Type of the output, like
+	// "application/json; charset=utf-8". Its media type is matched
+	// against the Accept header.
+	ContentType() string
+	// Render writes v to w.
+	Render(w io.Writer, v interface{}) error
+}
+
+// DefaultRenderers are the renderers Negotiate picks from when the router
+// has none set.
+var DefaultRenderers = []Renderer{JSONRenderer{}, XMLRenderer{}, TextRenderer{}}
+
+// Negotiate responds with v rendered in the format the client prefers,
+// going by its Accept header. It picks from the given renderers, or the
+// router's Renderers when none are given.
+//
+//	appRouter.Renderers = []router.Renderer{
+//		router.JSONRenderer{},
+//		router.XMLRenderer{},
+//		router.CSVRenderer{},
+//	}
+//
+//	cntxt.Negotiate(res, req, http.StatusOK, users)
+//
+//	// Or pick from renderers for this response only
+//	cntxt.Negotiate(res, req, http.StatusOK, user,
+//		router.HTMLRenderer{Template: templates, Name: "user.html"},
+//		router.JSONRenderer{},
+//	)
+//
+// When the client prefers multiple formats equally, or sends no Accept
+// header, the renderer listed first wins. When none of the formats are
+// acceptable, the ErrorHandler responds with a 406 and false is returned.
+// So is the case, with a 500, when v can't be rendered.
+func (cntxt *RequestContext) Negotiate(res http.ResponseWriter, req *http.Request, code int, v interface{}, renderers ...Renderer) bool {
+	if len(renderers) == 0 {
+		renderers = cntxt.renderers
+	}
+	if len(renderers) == 0 {
+		renderers = DefaultRenderers
+	}
+
+	res.Header().Add("Vary", "Accept")
+	renderer := negotiateRenderer(req.Header.Get("Accept"), renderers)
+	if renderer == nil {
+		cntxt.Error(res, req, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return false
+	}
+
+	var out bytes.Buffer
+	if err := renderer.Render(&out, v); err != nil {
+		cntxt.Error(res, req, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+	res.Header().Set("Content-Type", renderer.ContentType())
+	res.Header().Set("Content-Length", strconv.Itoa(out.Len()))
+	res.WriteHeader(code)
+	res.Write(out.Bytes())
+	return true
+}
+
+// Picks the renderer whose media type the Accept header prefers, nil
+// when none is acceptable. A missing header accepts anything.
+func negotiateRenderer(accept string, renderers []Renderer) Renderer {
+	if strings.TrimSpace(accept) == "" {
+		return renderers[0]
+	}
+	accepted := parseQualityValues(accept)
+
+	var best Renderer
+	var bestQuality float64
+	for _, renderer := range renderers {
+		quality := acceptQuality(accepted, mediaTypeOf(renderer.ContentType()))
+		if quality > bestQuality {
+			best, bestQuality = renderer, quality
+		}
+	}
+	return best
+}
+
+// Returns the quality of the most specific media range matching the
+// media type: "text/html" before "text/*" before "*/*".
+func acceptQuality(accepted []qualityValue, mediaType string) float64 {
+	if quality, ok := qualityOf(accepted, mediaType); ok {
+		return quality
+	}
+	if i := strings.Index(mediaType, "/"); i != -1 {
+		if quality, ok := qualityOf(accepted, mediaType[:i]+"/*"); ok {
+			return quality
+		}
+	}
+	quality, _ := qualityOf(accepted, "*/*")
+	return quality
+}
+
+// Returns the media type of a Content-Type, without parameters.
+func mediaTypeOf(contentType string) string {
+	if i := strings.Index(contentType, ";"); i != -1 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// JSONRenderer renders values as JSON.
+type JSONRenderer struct {
+	Indent string // Indents the output when set, like "  "
+}
+
+// ContentType returns "application/json; charset=utf-8".
+func (renderer JSONRenderer) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+// Render writes v as JSON.
+func (renderer JSONRenderer) Render(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", renderer.Indent)
+	return encoder.Encode(v)
+}
+
+// XMLRenderer renders values as XML.
+type XMLRenderer struct {
+	Indent string // Indents the output when set, like "  "
+}
+
+// ContentType returns "application/xml; charset=utf-8".
+func (renderer XMLRenderer) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+// Render writes v as an XML document.
+func (renderer XMLRenderer) Render(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", renderer.Indent)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// TextRenderer renders values as plain text, the way fmt.Print does.
+type TextRenderer struct{}
+
+// ContentType returns "text/plain; charset=utf-8".
+func (renderer TextRenderer) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+// Render writes v as text.
+func (renderer TextRenderer) Render(w io.Writer, v interface{}) error {
+	_, err := fmt.Fprint(w, v)
+	return err
+}
+
+// HTMLRenderer renders values with an html/template.
+type HTMLRenderer struct {
+	Template *template.Template
+	Name     string // Template to execute, the Template itself when empty
+}
+
+// ContentType returns "text/html; charset=utf-8".
+func (renderer HTMLRenderer) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+// Render executes the template with v as its data.
+func (renderer HTMLRenderer) Render(w io.Writer, v interface{}) error {
+	if renderer.Name == "" {
+		return renderer.Template.Execute(w, v)
+	}
+	return renderer.Template.ExecuteTemplate(w, renderer.Name, v)
+}
+
+// CSVRenderer renders values as CSV. Values can be a [][]string, or a
+// slice of structs. Structs are rendered with a header row holding the
+// names of their exported fields, or the names given by their csv tags.
+// Fields tagged `csv:"-"` are left out.
+type CSVRenderer struct {
+	Comma rune // Field delimiter, defaults to ','
+}
+
+// ContentType returns "text/csv; charset=utf-8".
+func (renderer CSVRenderer) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+// Render writes v as CSV.
+func (renderer CSVRenderer) Render(w io.Writer, v interface{}) error {
+	writer := csv.NewWriter(w)
+	if renderer.Comma != 0 {
+		writer.Comma = renderer.Comma
+	}
+
+	records, ok := v.([][]string)
+	if !ok {
+		var err error
+		if records, err = csvRecords(v); err != nil {
+			return err
+		}
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// Turns a slice of structs into records, headed by the field names.
+func csvRecords(v interface{}) ([][]string, error) {
+	slice := reflect.ValueOf(v)
+	if slice.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("router: can't render %T as CSV", v)
+	}
+	structType := slice.Type().Elem()
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("router: can't render %T as CSV", v)
+	}
+
+	var header []string
+	var fields []int
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name := field.Tag.Get("csv")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	records := [][]string{header}
+	for i := 0; i < slice.Len(); i++ {
+		elem := reflect.Indirect(slice.Index(i))
+		record := make([]string, len(fields))
+		if elem.IsValid() {
+			for j, field := range fields {
+				record[j] = fmt.Sprint(elem.Field(field).Interface())
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
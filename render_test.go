@@ -0,0 +1,111 @@
+package router
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type renderUser struct {
+	Name     string `json:"name" xml:"name" csv:"name"`
+	Age      int    `json:"age" xml:"age" csv:"age"`
+	Password string `json:"-" xml:"-" csv:"-"`
+}
+
+func (user renderUser) String() string {
+	return user.Name
+}
+
+func TestNegotiate(t *testing.T) {
+	templates := template.Must(template.New("user.html").Parse(`<h1>{{.Name}}</h1>`))
+	user := renderUser{Name: "toon<3", Age: 34, Password: "secret"}
+
+	aRouter := NewRouter()
+	aRouter.Get("/user", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Negotiate(res, req, http.StatusOK, user)
+	})
+	aRouter.Get("/page", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Negotiate(res, req, http.StatusOK, user,
+			HTMLRenderer{Template: templates, Name: "user.html"},
+			JSONRenderer{},
+		)
+	})
+
+	type testPair struct {
+		path        string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}
+
+	testPairs := []testPair{
+		{"/user", "", http.StatusOK, "application/json; charset=utf-8", "{\"name\":\"toon\\u003c3\",\"age\":34}\n"},
+		{"/user", "application/json", http.StatusOK, "application/json; charset=utf-8", "{\"name\":\"toon\\u003c3\",\"age\":34}\n"},
+		{"/user", "application/xml", http.StatusOK, "application/xml; charset=utf-8", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<renderUser><name>toon&lt;3</name><age>34</age></renderUser>\n"},
+		{"/user", "text/plain", http.StatusOK, "text/plain; charset=utf-8", "toon<3"},
+		{"/user", "text/*", http.StatusOK, "text/plain; charset=utf-8", "toon<3"},
+		{"/user", "*/*", http.StatusOK, "application/json; charset=utf-8", "{\"name\":\"toon\\u003c3\",\"age\":34}\n"},
+		{"/user", "application/json;q=0.5, application/xml", http.StatusOK, "application/xml; charset=utf-8", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<renderUser><name>toon&lt;3</name><age>34</age></renderUser>\n"},
+		{"/user", "*/*;q=0.1, application/json;q=0", http.StatusOK, "application/xml; charset=utf-8", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<renderUser><name>toon&lt;3</name><age>34</age></renderUser>\n"},
+		{"/user", "image/png", http.StatusNotAcceptable, "text/plain; charset=utf-8", "Not Acceptable\n"},
+		{"/page", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", http.StatusOK, "text/html; charset=utf-8", "<h1>toon&lt;3</h1>"},
+		{"/page", "application/json", http.StatusOK, "application/json; charset=utf-8", "{\"name\":\"toon\\u003c3\",\"age\":34}\n"},
+		{"/page", "application/xml", http.StatusNotAcceptable, "text/plain; charset=utf-8", "Not Acceptable\n"},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.code || res.Header().Get("Content-Type") != test.contentType || res.Body.String() != test.body {
+			t.Error("Expected ", test.code, " ", test.contentType, " ", test.body, " got ", res.Code, " ", res.Header().Get("Content-Type"), " ", res.Body.String(), " for ", test.accept)
+		}
+		if res.Header().Get("Vary") != "Accept" {
+			t.Error("Expected responses to vary by Accept got ", res.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestNegotiateRouterRenderers(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Renderers = []Renderer{CSVRenderer{}, JSONRenderer{Indent: " "}}
+	aRouter.Get("/users", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Negotiate(res, req, http.StatusOK, []renderUser{{Name: "toon", Age: 34}, {Name: "ket, jr", Age: 3}})
+	})
+	aRouter.Get("/invalid", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Negotiate(res, req, http.StatusOK, "not a slice")
+	})
+
+	type testPair struct {
+		path   string
+		accept string
+		code   int
+		body   string
+	}
+
+	testPairs := []testPair{
+		{"/users", "", http.StatusOK, "name,age\ntoon,34\n\"ket, jr\",3\n"},
+		{"/users", "application/json", http.StatusOK, "[\n {\n  \"name\": \"toon\",\n  \"age\": 34\n },\n {\n  \"name\": \"ket, jr\",\n  \"age\": 3\n }\n]\n"},
+		{"/users", "application/xml", http.StatusNotAcceptable, "Not Acceptable\n"},
+		{"/invalid", "text/csv", http.StatusInternalServerError, "Internal Server Error\n"},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		res := httptest.NewRecorder()
+		aRouter.ServeHTTP(res, req)
+
+		if res.Code != test.code || res.Body.String() != test.body {
+			t.Error("Expected ", test.code, " ", test.body, " got ", res.Code, " ", res.Body.String(), " for ", test.path, " ", test.accept)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestID
+// --------------------------------
+
+// RequestIDOptions configures the RequestID handler.
+type RequestIDOptions struct {
+	Header   string                       // Header to read and echo the ID in, defaults to "X-Request-ID"
+	Trusted  func(req *http.Request) bool // Whether to use the ID the client sent, defaults to never
+	Generate func() string                // Generates new IDs, defaults to 32 random hex characters
+}
+
+// Key of the request ID in the request's context.Context.
+type requestIDKey struct{}
+
+// RequestID returns a HandlerFunc making sure every request carries an ID.
+// Mount it first, so all other handlers can use it.
+//
+//	appRouter.Mount("/", router.RequestID(router.RequestIDOptions{
+//		Trusted: func(req *http.Request) bool { return isInternal(req.RemoteAddr) },
+//	}))
+//
+// The ID sent by the client is used when the request is trusted, otherwise
+// a new one is generated. It is echoed in the response headers, stored
+// in the requestContext (use `cntxt.RequestID()`, from a custom ErrorHandler
+// too) and in the request's context.Context so RequestIDTransport can
+// pass it on to outgoing requests.
+func RequestID(options RequestIDOptions) http.HandlerFunc {
+	if options.Header == "" {
+		options.Header = "X-Request-ID"
+	}
+	if options.Generate == nil {
+		options.Generate = generateRequestID
+	}
+
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+
+		id := req.Header.Get(options.Header)
+		if id == "" || !isValidRequestID(id) || options.Trusted == nil || !options.Trusted(req) {
+			id = options.Generate()
+		}
+
+		cntxt.lock.Lock()
+		cntxt.requestID = id
+		cntxt.lock.Unlock()
+		res.Header().Set(options.Header, id)
+
+		ctx := context.WithValue(req.Context(), requestIDKey{}, id)
+		cntxt.nextWithRequest(res, req.WithContext(ctx))
+	}
+}
+
+// RequestID returns the ID of the current request as set by
+// the RequestID handler.
+func (cntxt *RequestContext) RequestID() string {
+	cntxt.lock.Lock()
+	defer cntxt.lock.Unlock()
+	return cntxt.requestID
+}
+
+// RequestIDFromContext returns the request ID stored in the
+// context.Context by the RequestID handler.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDTransport is an http.RoundTripper passing the request ID on to
+// outgoing requests. Create outgoing requests with the incoming request's
+// context for it to find the ID.
+//
+//	client := &http.Client{Transport: &router.RequestIDTransport{}}
+//	outReq, _ := http.NewRequestWithContext(req.Context(), "GET", url, nil)
+//	client.Do(outReq)
+type RequestIDTransport struct {
+	Base   http.RoundTripper // Transport doing the actual request, defaults to http.DefaultTransport
+	Header string            // Header to send the ID in, defaults to "X-Request-ID"
+}
+
+// RoundTrip adds the request ID header and passes the request on.
+func (transport *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	header := transport.Header
+	if header == "" {
+		header = "X-Request-ID"
+	}
+
+	if id := RequestIDFromContext(req.Context()); id != "" && req.Header.Get(header) == "" {
+		// RoundTrippers should not modify the request
+		req = req.Clone(req.Context())
+		req.Header.Set(header, id)
+	}
+	return base.RoundTrip(req)
+}
+
+// Generates a random request ID.
+func generateRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// Reports whether the request ID sent by a client is reasonable
+// to echo in our responses and logs.
+func isValidRequestID(id string) bool {
+	if len(id) > 200 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
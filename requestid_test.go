@@ -0,0 +1,117 @@
+package router
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", RequestID(RequestIDOptions{
+		Trusted: func(req *http.Request) bool {
+			return req.Header.Get("X-Internal") == "yes"
+		},
+	}))
+
+	var fromContext, fromStdContext string
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		fromContext = Context(req).RequestID()
+		fromStdContext = RequestIDFromContext(req.Context())
+	})
+
+	// Untrusted clients get a new ID
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "from-client")
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	id := res.Header().Get("X-Request-ID")
+	if len(id) != 32 || id == "from-client" {
+		t.Error("Expected a generated ID got ", id)
+	}
+	if fromContext != id || fromStdContext != id {
+		t.Error("Expected the ID to be stored got ", fromContext, fromStdContext)
+	}
+
+	// Each request gets its own
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+	if other := res.Header().Get("X-Request-ID"); other == id {
+		t.Error("Expected a new ID for each request")
+	}
+
+	// Trusted clients can pass their own
+	req.Header.Set("X-Internal", "yes")
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if id := res.Header().Get("X-Request-ID"); id != "from-client" || fromContext != "from-client" {
+		t.Error("Expected the ID from the client got ", id)
+	}
+
+	// Unless they send something weird
+	req.Header.Set("X-Request-ID", "with spaces\n")
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if id := res.Header().Get("X-Request-ID"); len(id) != 32 {
+		t.Error("Expected a generated ID got ", id)
+	}
+}
+
+func TestRequestIDOptions(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", RequestID(RequestIDOptions{
+		Header:   "X-Correlation-ID",
+		Generate: func() string { return "generated" },
+	}))
+	aRouter.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err string, code int) {
+		http.Error(res, err+" ("+Context(req).RequestID()+")", code)
+	}
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Error(res, req, "oops", 500)
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if res.Header().Get("X-Correlation-ID") != "generated" {
+		t.Error("Expected the configured header and generator to be used got ", res.Header())
+	}
+	if res.Body.String() != "oops (generated)\n" {
+		t.Error("Expected the ErrorHandler to have access to the ID got ", res.Body.String())
+	}
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		received <- req.Header.Get("X-Request-ID")
+	}))
+	defer backend.Close()
+
+	client := &http.Client{Transport: &RequestIDTransport{}}
+
+	aRouter := NewRouter()
+	aRouter.Mount("/", RequestID(RequestIDOptions{}))
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		outReq, _ := http.NewRequestWithContext(req.Context(), "GET", backend.URL, nil)
+		outRes, err := client.Do(outReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(outRes.Body)
+		outRes.Body.Close()
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if id := <-received; id == "" || id != res.Header().Get("X-Request-ID") {
+		t.Error("Expected the request ID to be passed on got ", id)
+	}
+}
@@ -0,0 +1,421 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ResponseWriter
+// --------------------------------
+
+// ResponseWriter is the http.ResponseWriter handlers receive from the router.
+// It keeps track of what has been written, so handlers running before
+// the one generating the response (like a logger) can inspect it once
+// their call to Next returns.
+//
+// Grab it with `cntxt.Response()` or by type asserting the
+// http.ResponseWriter passed to the handler.
+//
+// It only implements http.Flusher, http.Hijacker, io.ReaderFrom and
+// http.Pusher when the underlying http.ResponseWriter does.
+type ResponseWriter interface {
+	http.ResponseWriter
+	// Status returns the status code sent, 0 when nothing has been sent yet.
+	Status() int
+	// Size returns the number of bytes written to the response body.
+	Size() int
+	// Written reports whether the headers have been sent.
+	Written() bool
+	// Unwrap returns the underlying http.ResponseWriter, which allows
+	// http.ResponseController to access it.
+	Unwrap() http.ResponseWriter
+}
+
+// responseWriter is the implementation of ResponseWriter.
+//
+// It does not implement the optional interfaces itself, those are
+// added by wrapping it in one of the structs returned by `wrap`.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	size    int
+	written bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	// Informational responses can be followed by the actual one.
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		rw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if !rw.written {
+		rw.status = code
+		rw.written = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	rw.writeHeaderIfNeeded()
+	n, err := rw.ResponseWriter.Write(data)
+	rw.size += n
+	return n, err
+}
+
+func (rw *responseWriter) Status() int {
+	return rw.status
+}
+
+func (rw *responseWriter) Size() int {
+	return rw.size
+}
+
+func (rw *responseWriter) Written() bool {
+	return rw.written
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Records the implicit 200 sent by the underlying ResponseWriter
+// when writing the body before the headers.
+func (rw *responseWriter) writeHeaderIfNeeded() {
+	if !rw.written {
+		rw.status = http.StatusOK
+		rw.written = true
+	}
+}
+
+// Prepares the responseWriter to be used for the next request.
+func (rw *responseWriter) reset(res http.ResponseWriter) {
+	rw.ResponseWriter = res
+	rw.status = 0
+	rw.size = 0
+	rw.written = false
+}
+
+// Flags for each of the optional interfaces the underlying
+// ResponseWriter might implement.
+const (
+	implementsFlusher = 1 << iota
+	implementsHijacker
+	implementsReaderFrom
+	implementsPusher
+)
+
+// Returns the flags for the optional interfaces the
+// underlying ResponseWriter implements.
+func (rw *responseWriter) implements() (flags int) {
+	if _, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flags |= implementsFlusher
+	}
+	if _, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		flags |= implementsHijacker
+	}
+	if _, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		flags |= implementsReaderFrom
+	}
+	if _, ok := rw.ResponseWriter.(http.Pusher); ok {
+		flags |= implementsPusher
+	}
+	return
+}
+
+// Wraps the responseWriter so it implements exactly the optional interfaces
+// for the given flags. A type switch on the result behaves just like it
+// would on the underlying ResponseWriter.
+func (rw *responseWriter) wrap(flags int) ResponseWriter {
+	f, h, r, p := flusher{rw}, hijacker{rw}, readerFrom{rw}, pusher{rw}
+	switch flags {
+	case 0:
+		return rw
+	case implementsFlusher:
+		return struct {
+			*responseWriter
+			flusher
+		}{rw, f}
+	case implementsHijacker:
+		return struct {
+			*responseWriter
+			hijacker
+		}{rw, h}
+	case implementsFlusher | implementsHijacker:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+		}{rw, f, h}
+	case implementsReaderFrom:
+		return struct {
+			*responseWriter
+			readerFrom
+		}{rw, r}
+	case implementsFlusher | implementsReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			readerFrom
+		}{rw, f, r}
+	case implementsHijacker | implementsReaderFrom:
+		return struct {
+			*responseWriter
+			hijacker
+			readerFrom
+		}{rw, h, r}
+	case implementsFlusher | implementsHijacker | implementsReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+			readerFrom
+		}{rw, f, h, r}
+	case implementsPusher:
+		return struct {
+			*responseWriter
+			pusher
+		}{rw, p}
+	case implementsFlusher | implementsPusher:
+		return struct {
+			*responseWriter
+			flusher
+			pusher
+		}{rw, f, p}
+	case implementsHijacker | implementsPusher:
+		return struct {
+			*responseWriter
+			hijacker
+			pusher
+		}{rw, h, p}
+	case implementsFlusher | implementsHijacker | implementsPusher:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+			pusher
+		}{rw, f, h, p}
+	case implementsReaderFrom | implementsPusher:
+		return struct {
+			*responseWriter
+			readerFrom
+			pusher
+		}{rw, r, p}
+	case implementsFlusher | implementsReaderFrom | implementsPusher:
+		return struct {
+			*responseWriter
+			flusher
+			readerFrom
+			pusher
+		}{rw, f, r, p}
+	case implementsHijacker | implementsReaderFrom | implementsPusher:
+		return struct {
+			*responseWriter
+			hijacker
+			readerFrom
+			pusher
+		}{rw, h, r, p}
+	default:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+			readerFrom
+			pusher
+		}{rw, f, h, r, p}
+	}
+}
+
+// Adds http.Flusher to the responseWriter.
+type flusher struct {
+	rw *responseWriter
+}
+
+func (f flusher) Flush() {
+	// Flushing sends the headers
+	f.rw.writeHeaderIfNeeded()
+	f.rw.ResponseWriter.(http.Flusher).Flush()
+}
+
+// Adds http.Hijacker to the responseWriter.
+type hijacker struct {
+	rw *responseWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := h.rw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		// The connection is no longer ours to write headers to
+		h.rw.written = true
+	}
+	return conn, buf, err
+}
+
+// Adds io.ReaderFrom to the responseWriter.
+type readerFrom struct {
+	rw *responseWriter
+}
+
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	r.rw.writeHeaderIfNeeded()
+	n, err := r.rw.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	r.rw.size += int(n)
+	return n, err
+}
+
+// Adds http.Pusher to the responseWriter.
+type pusher struct {
+	rw *responseWriter
+}
+
+func (p pusher) Push(target string, opts *http.PushOptions) error {
+	return p.rw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// Buffered responses
+// --------------------------------
+
+// bufferCommitter is implemented by the middleware embedding a
+// bufferedWriter, to decide how the buffered response is sent.
+type bufferCommitter interface {
+	// commit sends the headers and whatever has been buffered,
+	// streaming is set when the handlers flush the response.
+	commit(streaming bool) error
+}
+
+// bufferedWriter holds on to the response of the handlers until the
+// middleware embedding it, like Compress or Conditional, commits it.
+type bufferedWriter struct {
+	http.ResponseWriter
+	committer   bufferCommitter
+	limit       int          // Commits once more bytes than this are buffered
+	weakETag    bool         // Weakens a strong ETag when sending, for every status alike
+	out         io.Writer    // Set by commit to write through something other than the ResponseWriter
+	buf         bytes.Buffer // Holds the response until committing
+	status      int
+	wroteHeader bool // The handler wrote the headers
+	committed   bool // The headers were sent to the underlying ResponseWriter
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	// Informational responses are passed on right away
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		bw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if bw.wroteHeader {
+		return
+	}
+	bw.wroteHeader = true
+	bw.status = code
+}
+
+func (bw *bufferedWriter) Write(data []byte) (int, error) {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+	if bw.committed {
+		if bw.out != nil {
+			return bw.out.Write(data)
+		}
+		return bw.ResponseWriter.Write(data)
+	}
+
+	n, _ := bw.buf.Write(data)
+	if bw.buf.Len() > bw.limit {
+		if err := bw.committer.commit(false); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Flush commits the response and sends what has been buffered so far.
+func (bw *bufferedWriter) Flush() {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+	if !bw.committed {
+		bw.committer.commit(true)
+	}
+	if flusher, ok := bw.out.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := bw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Status returns the status code written by the handlers.
+func (bw *bufferedWriter) Status() int {
+	if rw, ok := bw.ResponseWriter.(ResponseWriter); ok && rw.Written() {
+		return rw.Status()
+	}
+	return bw.status
+}
+
+// Size returns the number of bytes sent to the underlying ResponseWriter.
+func (bw *bufferedWriter) Size() int {
+	if rw, ok := bw.ResponseWriter.(ResponseWriter); ok {
+		return rw.Size()
+	}
+	return 0
+}
+
+// Written reports whether the headers have been sent.
+func (bw *bufferedWriter) Written() bool {
+	return bw.committed
+}
+
+func (bw *bufferedWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// Hijack takes over the connection of the underlying ResponseWriter.
+// Nothing written to it is buffered.
+func (bw *bufferedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := bw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		// The connection is no longer ours to write the response to
+		bw.wroteHeader = true
+		bw.committed = true
+	}
+	return conn, buf, err
+}
+
+// Push initiates an HTTP/2 server push on the underlying ResponseWriter.
+func (bw *bufferedWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := bw.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Sends the status and whatever has been buffered. Once sent, writes
+// go through out when set, which writes to the underlying ResponseWriter.
+func (bw *bufferedWriter) send(out io.Writer) error {
+	bw.committed = true
+	bw.out = out
+	// Decided once for all statuses, so a 304 carries the same
+	// validator as the response it stands for
+	if etag := bw.Header().Get("ETag"); bw.weakETag && strings.HasPrefix(etag, `"`) {
+		bw.Header().Set("ETag", "W/"+etag)
+	}
+	bw.ResponseWriter.WriteHeader(bw.status)
+	if bw.buf.Len() == 0 {
+		return nil
+	}
+	if out == nil {
+		out = bw.ResponseWriter
+	}
+	_, err := out.Write(bw.buf.Bytes())
+	bw.buf.Reset()
+	return err
+}
@@ -0,0 +1,170 @@
+package router
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriterTracksResponse(t *testing.T) {
+	aRouter := NewRouter()
+
+	type response struct {
+		status, size int
+		written      bool
+	}
+	var before, after response
+
+	logger := func(res http.ResponseWriter, req *http.Request) {
+		rw := Context(req).Response()
+		before = response{rw.Status(), rw.Size(), rw.Written()}
+		Context(req).Next(res, req)
+		after = response{rw.Status(), rw.Size(), rw.Written()}
+	}
+
+	aRouter.Mount("/", logger)
+	aRouter.Get("/created", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusCreated)
+		res.WriteHeader(http.StatusAccepted)
+		res.Write([]byte("created"))
+	})
+	aRouter.Get("/implicit", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("hello "))
+		res.Write([]byte("world"))
+	})
+	aRouter.Get("/error", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Error(res, req, "oops", http.StatusTeapot)
+	})
+	aRouter.Get("/nothing", func(res http.ResponseWriter, req *http.Request) {})
+
+	type testPair struct {
+		path     string
+		expected response
+	}
+
+	testPairs := []testPair{
+		{"/created", response{http.StatusCreated, 7, true}},
+		{"/implicit", response{http.StatusOK, 11, true}},
+		{"/error", response{http.StatusTeapot, 5, true}},
+		{"/nothing", response{0, 0, false}},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+		if before != (response{}) {
+			t.Error("Expected nothing written before Next got ", before, " for path ", test.path)
+		}
+		if after != test.expected {
+			t.Error("Expected ", test.expected, " got ", after, " for path ", test.path)
+		}
+	}
+}
+
+func TestResponseWriterInformational(t *testing.T) {
+	aRouter := NewRouter()
+	var status int
+
+	aRouter.Mount("/", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Next(res, req)
+		status = Context(req).Response().Status()
+	})
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusEarlyHints)
+		res.WriteHeader(http.StatusNoContent)
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	if status != http.StatusNoContent {
+		t.Error("Expected the final status code to be recorded but got ", status)
+	}
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	for flags := 0; flags < 16; flags++ {
+		rw := &responseWriter{ResponseWriter: &fullResponseWriter{newDiscardResponseWriter()}}
+		wrapped := rw.wrap(flags)
+
+		if _, ok := wrapped.(http.Flusher); ok != (flags&implementsFlusher != 0) {
+			t.Error("Unexpected http.Flusher implementation for flags ", flags)
+		}
+		if _, ok := wrapped.(http.Hijacker); ok != (flags&implementsHijacker != 0) {
+			t.Error("Unexpected http.Hijacker implementation for flags ", flags)
+		}
+		if _, ok := wrapped.(io.ReaderFrom); ok != (flags&implementsReaderFrom != 0) {
+			t.Error("Unexpected io.ReaderFrom implementation for flags ", flags)
+		}
+		if _, ok := wrapped.(http.Pusher); ok != (flags&implementsPusher != 0) {
+			t.Error("Unexpected http.Pusher implementation for flags ", flags)
+		}
+	}
+
+	// The flags should follow the underlying ResponseWriter
+	rw := &responseWriter{ResponseWriter: &fullResponseWriter{newDiscardResponseWriter()}}
+	if flags := rw.implements(); flags != 15 {
+		t.Error("Expected all optional interfaces to be detected got ", flags)
+	}
+	rw = &responseWriter{ResponseWriter: newDiscardResponseWriter()}
+	if flags := rw.implements(); flags != 0 {
+		t.Error("Expected no optional interfaces to be detected got ", flags)
+	}
+	rw = &responseWriter{ResponseWriter: httptest.NewRecorder()}
+	if flags := rw.implements(); flags != implementsFlusher {
+		t.Error("Expected only http.Flusher to be detected got ", flags)
+	}
+}
+
+func TestResponseWriterOptionalInterfaces(t *testing.T) {
+	aRouter := NewRouter()
+	var size int
+
+	aRouter.Mount("/", func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Next(res, req)
+		size = Context(req).Response().Size()
+	})
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		if _, ok := res.(http.Hijacker); !ok {
+			t.Error("A HTTP/1 response should be hijackable")
+		}
+		res.(http.Flusher).Flush()
+		io.Copy(res, strings.NewReader("read from"))
+	})
+
+	server := httptest.NewServer(aRouter)
+	defer server.Close()
+
+	res, _ := http.Get(server.URL)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if string(body) != "read from" || size != 9 {
+		t.Error("Expected 'read from' of 9 bytes as response but got ", string(body), size)
+	}
+}
+
+// A ResponseWriter implementing all optional interfaces
+type fullResponseWriter struct {
+	*discardResponseWriter
+}
+
+func (res *fullResponseWriter) Flush() {}
+
+func (res *fullResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func (res *fullResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(ioutil.Discard, src)
+}
+
+func (res *fullResponseWriter) Push(target string, opts *http.PushOptions) error {
+	return nil
+}
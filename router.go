@@ -2,8 +2,10 @@ package router
 
 import (
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 // Stores
@@ -12,18 +14,46 @@ import (
 // Store to keep track of the current requestContexts in use.
 var requestContextStore = make(map[*http.Request]*RequestContext)
 
+// Guards the requestContextStore as requests are served concurrently.
+var requestContextStoreLock sync.RWMutex
+
+// Pool of requestContexts so they can be reused between requests
+// instead of allocating a new one each time.
+var requestContextPool = sync.Pool{
+	New: func() interface{} {
+		return new(RequestContext)
+	},
+}
+
 // Router
 // ----------------------
 
+// The HTTP methods routes can be registered for, in the order
+// they are reported to clients.
+var httpMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
 // A Router to register paths and requestHandlers to.
 //
 // Set a custom NotFoundHandler if you want to override go's default one.
 //
+// Set HandleOptions to have the router respond to OPTIONS requests with
+// the methods registered for the path in the "Allow" header.
+//
+// Set StripPrefix when the router is registered for a pattern like "/app/"
+// to have its routes match the path after it: "/app/users" matches "/users".
+//
 // There can be multiple per application, if so, don't forget to pass a
-// different pattern to `router.Handle()`.
+// different pattern to `router.Handle()`, or register them on a ServeMux
+// of your own with `router.HandleOn()`.
 type Router struct {
 	NotFoundHandler http.HandlerFunc // Specify a custom NotFoundHandler
 	ErrorHandler    ErrorHandler     // Specify a custom ErrorHandler
+	HandleOptions   bool             // Answer OPTIONS requests for paths registered with other methods
+	MaxBodyBytes    int64            // Maximum size of request bodies, unlimited when 0
+	Tracer          *Tracer          // Traces requests when set
+	StripPrefix     string           // Removed from request paths before matching routes
+	Debug           bool             // Pretty prints JSON responses
+	Renderers       []Renderer       // Formats Negotiate picks from, defaults to DefaultRenderers
 	routes          map[string][]*requestHandler
 	mounted         []mountedRequestHandler
 }
@@ -31,8 +61,8 @@ type Router struct {
 // NewRouter creates a router and returns a pointer to it so
 // you can start registering routes.
 //
-// Don't forget to call `router.Handle(pattern)` to actually use
-// the router.
+// Don't forget to call `router.Handle(pattern)` or `router.Run(addr)`
+// to actually use the router.
 func NewRouter() (router *Router) {
 	router = new(Router)
 
@@ -123,44 +153,125 @@ func (router *Router) Mount(mountPath string, handler http.HandlerFunc) {
 // This delegates to `http.Handle()` internally.
 //
 // Most of the times, you just want to do `router.Handle("/")`.
+// Or skip the DefaultServeMux and use `router.Run(addr)`.
 func (router *Router) Handle(pattern string) {
-	http.Handle(pattern, router)
+	router.HandleOn(http.DefaultServeMux, pattern)
+}
+
+// HandleOn registers the router for the given pattern on the mux, instead
+// of the DefaultServeMux. Handy to keep routers apart in tests, or to serve
+// multiple routers from one binary.
+//
+//	mux := http.NewServeMux()
+//	apiRouter.HandleOn(mux, "/api/")
+//	appRouter.HandleOn(mux, "/")
+//
+// The router being an http.Handler, it can also be passed to anything
+// accepting one directly.
+func (router *Router) HandleOn(mux *http.ServeMux, pattern string) {
+	mux.Handle(pattern, router)
 }
 
 // Needed by go to actually start handling the registered routes.
 // You don't need to call this yourself.
 func (router *Router) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	unMatched := true
+	if router.StripPrefix != "" {
+		stripped, ok := stripPrefix(req, router.StripPrefix)
+		if !ok {
+			router.notFound(res, req)
+			return
+		}
+		req = stripped
+	}
+
+	// Grab a requestContext from the pool, its Params
+	// are used as buffer while matching.
+	cntxt := requestContextPool.Get().(*RequestContext)
 
 	// For each of the registered routes for this request method...
 	for _, reqHandler := range router.routes[req.Method] {
+		var isAMatch bool
 		// Only when the route matches...
-		if isAMatch, withParams := reqHandler.matches(req.URL.Path); isAMatch {
-			unMatched = false
-
-			// Create a RequestContext
-			cntxt := new(RequestContext)
-			// Store the requestContext
-			requestContextStore[req] = cntxt
-			// Capture the route params
-			cntxt.Params = withParams
-			// Attach the handlers to the context
-			cntxt.handlers = reqHandler.Handlers
-			// Set the ErrorHandler
-			cntxt.errorHandler = router.ErrorHandler
-			// Dispatch the first handler,
-			// the request is being served.
-			cntxt.Next(res, req)
-			// Clean up
-			delete(requestContextStore, req)
-			break
+		if isAMatch, cntxt.params = reqHandler.matches(req.URL.Path, cntxt.params[:0]); isAMatch {
+			router.dispatch(cntxt, reqHandler.Path, reqHandler.Handlers, res, req)
+			return
+		}
+	}
+
+	// Answer OPTIONS requests for paths registered for other methods,
+	// still giving the mounted handlers a chance to handle them.
+	if req.Method == "OPTIONS" && router.HandleOptions {
+		if methods, reqHandler := router.allowedMethods(req.URL.Path); reqHandler != nil {
+			_, cntxt.params = reqHandler.matches(req.URL.Path, cntxt.params[:0])
+			handlers := append(router.handlersToMountFor(reqHandler.Path), optionsHandler(methods))
+			router.dispatch(cntxt, reqHandler.Path, handlers, res, req)
+			return
 		}
 	}
 
 	// Nothing found...
-	if unMatched {
-		router.notFound(res, req)
+	releaseContext(cntxt)
+	router.notFound(res, req)
+}
+
+// Helper function to dispatch the handlers of the matched route.
+func (router *Router) dispatch(cntxt *RequestContext, route string, handlers []http.HandlerFunc, res http.ResponseWriter, req *http.Request) {
+	// Attach the route and its handlers to the context
+	cntxt.route = route
+	// The map is kept between requests, so static routes don't pay for it
+	if cntxt.Params == nil {
+		cntxt.Params = make(map[string]string, len(cntxt.params))
+	}
+	cntxt.params.fill(cntxt.Params)
+	cntxt.handlers = handlers
+	// Set the ErrorHandler
+	cntxt.errorHandler = router.ErrorHandler
+	cntxt.debug = router.Debug
+	cntxt.renderers = router.Renderers
+	if router.Tracer != nil {
+		req = router.Tracer.start(cntxt, req)
+	}
+	// Store the requestContext
+	storeContext(req, cntxt)
+	// Dispatch the first handler with a ResponseWriter keeping
+	// track of the response, the request is being served.
+	response := cntxt.wrapResponse(res)
+	if router.MaxBodyBytes > 0 {
+		if body := cntxt.limitBody(req); body != nil {
+			body.limit = router.MaxBodyBytes
+		}
+	}
+	cntxt.Next(response, req)
+	cntxt.checkBody(response, req)
+	if router.Tracer != nil {
+		router.Tracer.finish(cntxt)
+	}
+	// Clean up, unless a timed out handler
+	// chain is still using the context.
+	deleteContext(req)
+	if cntxt.finish() {
+		releaseContext(cntxt)
+	}
+}
+
+// Returns the methods for which a route matching the given path has been
+// registered, together with the first matching route.
+func (router *Router) allowedMethods(path string) (methods []string, matched *requestHandler) {
+	for _, method := range httpMethods {
+		for _, reqHandler := range router.routes[method] {
+			if isAMatch, _ := reqHandler.matches(path, nil); isAMatch {
+				methods = append(methods, method)
+				if matched == nil {
+					matched = reqHandler
+				}
+				break
+			}
+		}
+	}
+	if matched != nil && router.HandleOptions && !containsString(methods, "OPTIONS") {
+		methods = append(methods, "OPTIONS")
 	}
+	return
 }
 
 // Helper function to actually register the requestHandler on the router.
@@ -169,6 +280,43 @@ func (router *Router) registerRequestHandler(method string, path string, handler
 	router.routes[method] = append(router.routes[method], reqHandler)
 }
 
+// Returns a copy of the request with the prefix removed from its path,
+// like http.StripPrefix. The prefix may end in a slash or not.
+func stripPrefix(req *http.Request, prefix string) (*http.Request, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	path, ok := trimPathPrefix(req.URL.Path, prefix)
+	if !ok {
+		return req, false
+	}
+	rawPath := req.URL.RawPath
+	if rawPath != "" {
+		if rawPath, ok = trimPathPrefix(rawPath, prefix); !ok {
+			return req, false
+		}
+	}
+
+	stripped := new(http.Request)
+	*stripped = *req
+	stripped.URL = new(url.URL)
+	*stripped.URL = *req.URL
+	stripped.URL.Path = path
+	stripped.URL.RawPath = rawPath
+	return stripped, true
+}
+
+// Trims the prefix from the path, as long as it is a whole
+// segment: "/app" is a prefix of "/app/users", not of "/apps".
+func trimPathPrefix(path, prefix string) (string, bool) {
+	if !strings.HasPrefix(path, prefix) {
+		return path, false
+	}
+	path = path[len(prefix):]
+	if path == "" {
+		return "/", true
+	}
+	return path, path[0] == '/'
+}
+
 // Helper function to dispatch the correct NotFoundHandler.
 func (router *Router) notFound(res http.ResponseWriter, req *http.Request) {
 	if router.NotFoundHandler != nil {
@@ -213,6 +361,26 @@ func (router *Router) handlersToMountFor(path string) (mountedMiddleware []http.
 // Private helper funcs
 // ---------------------------
 
+// Stores the requestContext so it can be retrieved via `Context(req)`.
+func storeContext(req *http.Request, cntxt *RequestContext) {
+	requestContextStoreLock.Lock()
+	requestContextStore[req] = cntxt
+	requestContextStoreLock.Unlock()
+}
+
+// Removes the requestContext from the store once the request is served.
+func deleteContext(req *http.Request) {
+	requestContextStoreLock.Lock()
+	delete(requestContextStore, req)
+	requestContextStoreLock.Unlock()
+}
+
+// Resets the requestContext and puts it back in the pool.
+func releaseContext(cntxt *RequestContext) {
+	cntxt.reset()
+	requestContextPool.Put(cntxt)
+}
+
 // Some paths use tokens like "/user/:userid" where "userid" is the token.
 //
 // This function builds a string to be compiled as a regexp to match those
@@ -234,6 +402,25 @@ func buildRegexpFor(path string) (regexpPath string, withParamNames []string) {
 	return
 }
 
+// Responds to OPTIONS requests with the methods allowed for the path.
+func optionsHandler(methods []string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Allow", allow)
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Reports whether the list contains the given string.
+func containsString(list []string, val string) bool {
+	for _, item := range list {
+		if item == val {
+			return true
+		}
+	}
+	return false
+}
+
 // ErrorHandler interface to which an errorHandler needs to comply.
 //
 // Used as a field in the router to override the default RrrorHandler implementation.
@@ -112,7 +112,7 @@ func TestMatches(t *testing.T) {
 	type testPair struct {
 		path           string
 		expectedMatch  bool
-		expectedParams map[string]string
+		expectedParams Params
 	}
 
 	aRouter := NewRouter()
@@ -120,15 +120,15 @@ func TestMatches(t *testing.T) {
 	reqHandler := aRouter.makeRequestHandler("/hello", handler)
 
 	testPairs := []testPair{
-		{"/hello", true, make(map[string]string)},
-		{"/hello/", false, make(map[string]string)},
-		{"/helloo", false, make(map[string]string)},
-		{"/helo", false, make(map[string]string)},
-		{"/hello/something", false, make(map[string]string)},
+		{"/hello", true, nil},
+		{"/hello/", false, nil},
+		{"/helloo", false, nil},
+		{"/helo", false, nil},
+		{"/hello/something", false, nil},
 	}
 
 	for _, test := range testPairs {
-		isAMatch, withParams := reqHandler.matches(test.path)
+		isAMatch, withParams := reqHandler.matches(test.path, nil)
 		if isAMatch != test.expectedMatch {
 			t.Error("Expected ", test.expectedMatch, " got ", isAMatch, " for path ", test.path)
 		}
@@ -141,16 +141,16 @@ func TestMatches(t *testing.T) {
 	reqHandler = aRouter.makeRequestHandler("/hello/world", handler)
 
 	testPairs = []testPair{
-		{"/hello", false, make(map[string]string)},
-		{"/hello/", false, make(map[string]string)},
-		{"/hello/world", true, make(map[string]string)},
-		{"/helloo/world", false, make(map[string]string)},
-		{"/hello/world/", false, make(map[string]string)},
-		{"/hello/something", false, make(map[string]string)},
+		{"/hello", false, nil},
+		{"/hello/", false, nil},
+		{"/hello/world", true, nil},
+		{"/helloo/world", false, nil},
+		{"/hello/world/", false, nil},
+		{"/hello/something", false, nil},
 	}
 
 	for _, test := range testPairs {
-		isAMatch, withParams := reqHandler.matches(test.path)
+		isAMatch, withParams := reqHandler.matches(test.path, nil)
 		if isAMatch != test.expectedMatch {
 			t.Error("Expected ", test.expectedMatch, " got ", isAMatch, " for path ", test.path)
 		}
@@ -163,17 +163,17 @@ func TestMatches(t *testing.T) {
 	reqHandler = aRouter.makeRequestHandler("/hello/:world", handler)
 
 	testPairs = []testPair{
-		{"/hello", false, make(map[string]string)},
-		{"/hello/", false, make(map[string]string)},
-		{"/hello/world", true, map[string]string{"world": "world"}},
-		{"/hello/:world", true, map[string]string{"world": ":world"}},
-		{"/hello/14", true, map[string]string{"world": "14"}},
-		{"/hello/15/", false, make(map[string]string)},
-		{"/hello/15/something", false, make(map[string]string)},
+		{"/hello", false, nil},
+		{"/hello/", false, nil},
+		{"/hello/world", true, Params{{"world", "world"}}},
+		{"/hello/:world", true, Params{{"world", ":world"}}},
+		{"/hello/14", true, Params{{"world", "14"}}},
+		{"/hello/15/", false, nil},
+		{"/hello/15/something", false, nil},
 	}
 
 	for _, test := range testPairs {
-		isAMatch, withParams := reqHandler.matches(test.path)
+		isAMatch, withParams := reqHandler.matches(test.path, nil)
 		if isAMatch != test.expectedMatch {
 			t.Error("Expected ", test.expectedMatch, " got ", isAMatch, " for path ", test.path)
 		}
@@ -186,18 +186,18 @@ func TestMatches(t *testing.T) {
 	reqHandler = aRouter.makeRequestHandler("/hello/:world/and/:goodmorning", handler)
 
 	testPairs = []testPair{
-		{"/hello", false, make(map[string]string)},
-		{"/hello/:world/and/:goodmorning", true, map[string]string{"world": ":world", "goodmorning": ":goodmorning"}},
-		{"/hello/12/and/54", true, map[string]string{"world": "12", "goodmorning": "54"}},
-		{"/hello/16/and/something-else", true, map[string]string{"world": "16", "goodmorning": "something-else"}},
-		{"/hello/:world/and/:goodmorning/", false, make(map[string]string)},
-		{"/hello/12/and/54/", false, make(map[string]string)},
-		{"/hello/16/and/something-else/", false, make(map[string]string)},
-		{"/hello/:world/and/:goodmorning/456", false, make(map[string]string)},
+		{"/hello", false, nil},
+		{"/hello/:world/and/:goodmorning", true, Params{{"world", ":world"}, {"goodmorning", ":goodmorning"}}},
+		{"/hello/12/and/54", true, Params{{"world", "12"}, {"goodmorning", "54"}}},
+		{"/hello/16/and/something-else", true, Params{{"world", "16"}, {"goodmorning", "something-else"}}},
+		{"/hello/:world/and/:goodmorning/", false, nil},
+		{"/hello/12/and/54/", false, nil},
+		{"/hello/16/and/something-else/", false, nil},
+		{"/hello/:world/and/:goodmorning/456", false, nil},
 	}
 
 	for _, test := range testPairs {
-		isAMatch, withParams := reqHandler.matches(test.path)
+		isAMatch, withParams := reqHandler.matches(test.path, nil)
 		if isAMatch != test.expectedMatch {
 			t.Error("Expected ", test.expectedMatch, " got ", isAMatch, " for path ", test.path)
 		}
@@ -932,6 +932,252 @@ func TestErrorHandler(t *testing.T) {
 	}
 }
 
+// Test aborting the handler chain without an error
+func TestAbort(t *testing.T) {
+	aRouter := NewRouter()
+
+	var calls []string
+	outerAfterNext := false
+	outerSawAbort := false
+
+	outer := func(res http.ResponseWriter, req *http.Request) {
+		calls = append(calls, "outer")
+		Context(req).Next(res, req)
+		outerAfterNext = true
+		outerSawAbort = Context(req).IsAborted()
+
+		// Calling Next again after an abort does nothing
+		Context(req).Next(res, req)
+	}
+
+	redirect := func(res http.ResponseWriter, req *http.Request) {
+		calls = append(calls, "redirect")
+		http.Redirect(res, req, "/elsewhere", http.StatusFound)
+		Context(req).Abort()
+		Context(req).Next(res, req)
+		calls = append(calls, "redirect after next")
+	}
+
+	final := func(res http.ResponseWriter, req *http.Request) {
+		calls = append(calls, "final")
+		res.Write([]byte("final"))
+	}
+
+	aRouter.Mount("/", outer)
+	aRouter.Get("/", redirect, final)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	aRouter.ServeHTTP(res, req)
+
+	if !reflect.DeepEqual(calls, []string{"outer", "redirect", "redirect after next"}) {
+		t.Error("Expected no handler after the abort to be called but got ", calls)
+	}
+	if !outerAfterNext || !outerSawAbort {
+		t.Error("The code after Next in outer handlers should execute and see the abort")
+	}
+	if res.Code != http.StatusFound ||
+		res.Header().Get("Location") != "/elsewhere" {
+		t.Error("Expected the aborting handler's response but got ", res.Code)
+	}
+}
+
+// Test skipping handlers and jumping to the last one
+func TestSkipAndLast(t *testing.T) {
+	aRouter := NewRouter()
+
+	var calls []string
+	handler := func(name string) http.HandlerFunc {
+		return func(res http.ResponseWriter, req *http.Request) {
+			calls = append(calls, name)
+			Context(req).Next(res, req)
+		}
+	}
+
+	skipOne := func(res http.ResponseWriter, req *http.Request) {
+		calls = append(calls, "skip")
+		Context(req).Skip(1)
+		Context(req).Next(res, req)
+	}
+
+	toLast := func(res http.ResponseWriter, req *http.Request) {
+		calls = append(calls, "last")
+		Context(req).Last(res, req)
+		calls = append(calls, "last after next")
+	}
+
+	aRouter.Get("/skip", skipOne, handler("first"), handler("second"))
+	aRouter.Get("/last", toLast, handler("first"), handler("second"), handler("final"))
+	aRouter.Get("/skip-all", skipOne, handler("first"))
+	aRouter.Get("/skip-back", handler("first"), func(res http.ResponseWriter, req *http.Request) {
+		calls = append(calls, "back")
+		Context(req).Skip(-5)
+		Context(req).Next(res, req)
+	}, handler("second"))
+
+	for path, expected := range map[string][]string{
+		"/skip":      {"skip", "second"},
+		"/last":      {"last", "final", "last after next"},
+		"/skip-all":  {"skip"},
+		"/skip-back": {"first", "back", "second"},
+	} {
+		calls = nil
+		req, _ := http.NewRequest("GET", path, nil)
+		aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+		if !reflect.DeepEqual(calls, expected) {
+			t.Error("Expected ", expected, " got ", calls, " for path ", path)
+		}
+	}
+}
+
+// Test inspecting the handler chain
+func TestInspectHandlers(t *testing.T) {
+	aRouter := NewRouter()
+
+	type position struct {
+		index, remaining int
+	}
+	var positions []position
+	var handlersLen int
+
+	inspect := func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		positions = append(positions, position{cntxt.Index(), cntxt.Remaining()})
+		handlersLen = len(cntxt.Handlers())
+		cntxt.Next(res, req)
+	}
+
+	aRouter.Mount("/", inspect)
+	aRouter.Get("/", inspect, inspect)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := []position{{0, 2}, {1, 1}, {2, 0}}
+	if !reflect.DeepEqual(positions, expected) {
+		t.Error("Expected ", expected, " got ", positions)
+	}
+	if handlersLen != 3 {
+		t.Error("Expected 3 handlers got ", handlersLen)
+	}
+}
+
+// Test requestContexts are reset before being reused
+func TestContextReuse(t *testing.T) {
+	aRouter := NewRouter()
+
+	storeHandler := func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+		if _, ok := cntxt.Get("user"); ok {
+			t.Error("The store should be empty for a new request")
+		}
+		_ = cntxt.Set("user", cntxt.Params["userid"])
+		res.Write([]byte(cntxt.Params["userid"]))
+	}
+
+	staticHandler := func(res http.ResponseWriter, req *http.Request) {
+		if params := Context(req).Params; len(params) != 0 {
+			t.Error("Expected no params but got ", params)
+		}
+		res.Write([]byte("static"))
+	}
+
+	aRouter.Get("/user/:userid", storeHandler)
+	aRouter.Get("/static", staticHandler)
+
+	server := httptest.NewServer(aRouter)
+	defer server.Close()
+
+	for _, path := range []string{"/user/1", "/static", "/user/2", "/static"} {
+		res, _ := http.Get(server.URL + path)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		expected := strings.TrimPrefix(path, "/")
+		if strings.HasPrefix(path, "/user/") {
+			expected = strings.TrimPrefix(path, "/user/")
+		}
+		if string(body) != expected {
+			t.Error("Expected ", expected, " got ", string(body))
+		}
+	}
+}
+
+// Test requests can be served concurrently (run with -race)
+func TestServeHTTPConcurrently(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Get("/user/:userid", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(Context(req).Params["userid"]))
+	})
+
+	done := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func(userid string) {
+			for j := 0; j < 50; j++ {
+				res := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/user/"+userid, nil)
+				aRouter.ServeHTTP(res, req)
+				if res.Body.String() != userid {
+					t.Error("Expected ", userid, " got ", res.Body.String())
+				}
+			}
+			done <- true
+		}(string(rune('a' + i)))
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+}
+
+// Test dispatching a static route does not allocate
+func TestServeHTTPAllocs(t *testing.T) {
+	aRouter := NewRouter()
+	handler := func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Next(res, req)
+	}
+	aRouter.Mount("/", handler)
+	aRouter.Get("/hello/world", handler, handler)
+
+	res := newDiscardResponseWriter()
+	req, _ := http.NewRequest("GET", "/hello/world", nil)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		aRouter.ServeHTTP(res, req)
+	})
+	if allocs != 0 {
+		t.Error("Expected 0 allocations for a static route but got ", allocs)
+	}
+}
+
+func BenchmarkServeHTTPStatic(b *testing.B) {
+	aRouter := NewRouter()
+	aRouter.Get("/hello/world", func(res http.ResponseWriter, req *http.Request) {})
+
+	res := newDiscardResponseWriter()
+	req, _ := http.NewRequest("GET", "/hello/world", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aRouter.ServeHTTP(res, req)
+	}
+}
+
+func BenchmarkServeHTTPTokenized(b *testing.B) {
+	aRouter := NewRouter()
+	aRouter.Get("/hello/:world", func(res http.ResponseWriter, req *http.Request) {})
+
+	res := newDiscardResponseWriter()
+	req, _ := http.NewRequest("GET", "/hello/world", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aRouter.ServeHTTP(res, req)
+	}
+}
+
 // Helpers....
 // ---------------------------------
 
@@ -957,3 +1203,98 @@ func isHandlersSliceDeepEqual(first []http.HandlerFunc, second []http.HandlerFun
 	}
 	return true
 }
+
+// A ResponseWriter throwing away everything written to it, so it
+// does not influence allocation counts.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func newDiscardResponseWriter() *discardResponseWriter {
+	return &discardResponseWriter{header: make(http.Header)}
+}
+
+func (res *discardResponseWriter) Header() http.Header {
+	return res.header
+}
+
+func (res *discardResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (res *discardResponseWriter) WriteHeader(code int) {}
+
+func TestHandleOn(t *testing.T) {
+	appRouter := NewRouter()
+	appRouter.StripPrefix = "/app/"
+	appRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("app index"))
+	})
+	appRouter.Get("/user/:userid", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("app user " + Context(req).Params["userid"] + " " + req.URL.Path))
+	})
+
+	otherRouter := NewRouter()
+	otherRouter.Get("/app/user/:userid", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("other user"))
+	})
+	otherRouter.Get("/apps", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("other apps"))
+	})
+
+	mux := http.NewServeMux()
+	appRouter.HandleOn(mux, "/app/")
+	otherRouter.HandleOn(mux, "/")
+
+	type testPair struct {
+		path string
+		code int
+		body string
+	}
+
+	testPairs := []testPair{
+		{"/app/", http.StatusOK, "app index"},
+		{"/app/user/14", http.StatusOK, "app user 14 /user/14"},
+		{"/apps", http.StatusOK, "other apps"},
+		{"/user/14", http.StatusNotFound, "404 page not found\n"},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+
+		if res.Code != test.code || res.Body.String() != test.body {
+			t.Error("Expected ", test.code, " ", test.body, " got ", res.Code, " ", res.Body.String(), " for ", test.path)
+		}
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	type testPair struct {
+		prefix string
+		path   string
+		ok     bool
+		result string
+	}
+
+	testPairs := []testPair{
+		{"/app", "/app", true, "/"},
+		{"/app/", "/app/", true, "/"},
+		{"/app", "/app/users", true, "/users"},
+		{"/app/", "/app/users", true, "/users"},
+		{"/app", "/apps", false, ""},
+		{"/app", "/other", false, ""},
+	}
+
+	for _, test := range testPairs {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		stripped, ok := stripPrefix(req, test.prefix)
+		if ok != test.ok || (ok && stripped.URL.Path != test.result) {
+			t.Error("Expected ", test.ok, " ", test.result, " got ", ok, " ", stripped.URL.Path, " for ", test.prefix, " ", test.path)
+		}
+		if req.URL.Path != test.path {
+			t.Error("Expected the request not to be modified got ", req.URL.Path)
+		}
+	}
+}
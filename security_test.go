@@ -0,0 +1,100 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", SecurityHeaders(SecurityHeadersOptions{
+		HSTSMaxAge:            24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-{nonce}'; frame-ancestors 'none'",
+		PermissionsPolicy:     "camera=()",
+	}))
+
+	var nonce string
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		nonce = Context(req).CSPNonce()
+	})
+	aRouter.Get("/widget", SecurityHeader("X-Frame-Options", ""), CSPDirective("frame-ancestors", "https://partner.com"), func(res http.ResponseWriter, req *http.Request) {})
+	aRouter.Get("/legacy", CSPDirective("frame-ancestors", ""), CSPDirective("object-src", "'none'"), func(res http.ResponseWriter, req *http.Request) {})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	expected := map[string]string{
+		"Strict-Transport-Security": "max-age=86400; includeSubDomains",
+		"Content-Security-Policy":   "default-src 'self'; script-src 'self' 'nonce-" + nonce + "'; frame-ancestors 'none'",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+		"Permissions-Policy":        "camera=()",
+	}
+	for name, value := range expected {
+		if res.Header().Get(name) != value {
+			t.Error("Expected ", name, " to be ", value, " got ", res.Header().Get(name))
+		}
+	}
+	if len(nonce) != 24 {
+		t.Error("Expected a nonce got ", nonce)
+	}
+
+	// Each request gets its own nonce
+	firstNonce := nonce
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+	if nonce == firstNonce {
+		t.Error("Expected a new nonce for each request")
+	}
+
+	// Overridden for a route
+	req, _ = http.NewRequest("GET", "/widget", nil)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if _, ok := res.Header()["X-Frame-Options"]; ok {
+		t.Error("Expected X-Frame-Options to be removed got ", res.Header().Get("X-Frame-Options"))
+	}
+	if csp := res.Header().Get("Content-Security-Policy"); !strings.HasSuffix(csp, "; frame-ancestors https://partner.com") {
+		t.Error("Expected frame-ancestors to be relaxed got ", csp)
+	}
+
+	req, _ = http.NewRequest("GET", "/legacy", nil)
+	res = httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	if csp := res.Header().Get("Content-Security-Policy"); strings.Contains(csp, "frame-ancestors") || !strings.HasSuffix(csp, "; object-src 'none'") {
+		t.Error("Expected directives to be removed and added got ", csp)
+	}
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Mount("/", SecurityHeaders(SecurityHeadersOptions{
+		ContentSecurityPolicy: "default-src 'self'",
+		CSPReportOnly:         true,
+	}))
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		if Context(req).CSPNonce() != "" {
+			t.Error("Expected no nonce when the policy does not use it")
+		}
+	})
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	header := res.Header()
+	if header.Get("Strict-Transport-Security") != "" || header.Get("Permissions-Policy") != "" || header.Get("Content-Security-Policy") != "" {
+		t.Error("Expected unconfigured headers not to be sent got ", header)
+	}
+	if header.Get("Content-Security-Policy-Report-Only") != "default-src 'self'" || header.Get("X-Frame-Options") != "DENY" {
+		t.Error("Expected the defaults got ", header)
+	}
+}
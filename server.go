@@ -0,0 +1,239 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Server
+// --------------------------------
+
+// ServerOptions configures a server.
+type ServerOptions struct {
+	Addrs           []string      // Addresses to listen on like ":3000" or "unix:/run/app.sock", defaults to ":http"
+	ShutdownTimeout time.Duration // Time to drain requests in flight, defaults to 30 seconds
+	ShutdownDelay   time.Duration // Time to keep serving after shutdown starts, so load balancers notice
+	Signals         []os.Signal   // Signals to shut down on, defaults to SIGINT and SIGTERM
+}
+
+// Server serves a router until it receives a signal to stop, then shuts
+// down gracefully.
+//
+//	server := router.NewServer(appRouter, router.ServerOptions{
+//		Addrs: []string{":3000", "unix:/run/app.sock"},
+//	})
+//	server.OnShutdown(checks.Shutdown)
+//	server.AfterShutdown(func(ctx context.Context) error {
+//		return db.Close()
+//	})
+//	log.Fatal(server.Serve(context.Background()))
+//
+// Shutting down goes as follows:
+//
+//   - The OnShutdown hooks are run, like making readiness checks fail.
+//   - Requests keep being served for the ShutdownDelay.
+//   - The listeners are closed and the requests in flight drained. Those
+//     taking longer than the ShutdownTimeout get their connection closed.
+//   - The AfterShutdown hooks are run, like closing database connections.
+//
+// A second signal while shutting down stops the process right away.
+//
+// Configure timeouts, TLS and the like on the HTTPServer.
+type Server struct {
+	HTTPServer    *http.Server
+	options       ServerOptions
+	lock          sync.Mutex
+	listeners     []net.Listener
+	onShutdown    []func()
+	afterShutdown []func(ctx context.Context) error
+	shutdownOnce  sync.Once
+	shutdownErr   error
+}
+
+// NewServer creates a server for the handler, usually a router.
+func NewServer(handler http.Handler, options ServerOptions) *Server {
+	if len(options.Addrs) == 0 {
+		options.Addrs = []string{":http"}
+	}
+	if options.ShutdownTimeout == 0 {
+		options.ShutdownTimeout = 30 * time.Second
+	}
+	if options.Signals == nil {
+		options.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return &Server{
+		HTTPServer: &http.Server{Handler: handler},
+		options:    options,
+	}
+}
+
+// Run serves the router on the addresses, ":http" when none are given,
+// until it receives SIGINT or SIGTERM.
+//
+//	log.Fatal(appRouter.Run(":3000"))
+func (router *Router) Run(addrs ...string) error {
+	return NewServer(router, ServerOptions{Addrs: addrs}).Serve(context.Background())
+}
+
+// OnShutdown registers a hook run when shutting down starts,
+// before requests are drained.
+func (server *Server) OnShutdown(hook func()) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.onShutdown = append(server.onShutdown, hook)
+}
+
+// AfterShutdown registers a hook run once requests are drained. The
+// context given expires after the ShutdownTimeout.
+func (server *Server) AfterShutdown(hook func(ctx context.Context) error) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.afterShutdown = append(server.afterShutdown, hook)
+}
+
+// Listen opens the listeners, if not done already. Serve calls it, call
+// it yourself to find out on which addresses the server listens before
+// serving.
+func (server *Server) Listen() error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.listeners != nil {
+		return nil
+	}
+
+	listeners := make([]net.Listener, 0, len(server.options.Addrs))
+	for _, addr := range server.options.Addrs {
+		listener, err := listen(addr)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, listener)
+	}
+	server.listeners = listeners
+	return nil
+}
+
+// Addrs returns the addresses listened on, once listening.
+func (server *Server) Addrs() []net.Addr {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	addrs := make([]net.Addr, len(server.listeners))
+	for i, listener := range server.listeners {
+		addrs[i] = listener.Addr()
+	}
+	return addrs
+}
+
+// Serve listens and serves requests until the context is done, one of
+// the signals is received or Shutdown is called. It returns once shut
+// down, with the errors encountered.
+func (server *Server) Serve(ctx context.Context) error {
+	if err := server.Listen(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, server.options.Signals...)
+	defer stop()
+
+	server.lock.Lock()
+	listeners := server.listeners
+	server.lock.Unlock()
+
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- server.HTTPServer.Serve(listener)
+		}(listener)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+		if err == http.ErrServerClosed {
+			// Shutdown was called
+			err = nil
+		}
+	}
+	// Let a second signal stop the process
+	stop()
+
+	return errors.Join(err, server.Shutdown(context.Background()))
+}
+
+// Shutdown shuts the server down gracefully, see Server. Calling it
+// again waits for the first call to finish, returning its errors.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.shutdownOnce.Do(func() {
+		server.shutdownErr = server.shutdown(ctx)
+	})
+	return server.shutdownErr
+}
+
+func (server *Server) shutdown(ctx context.Context) error {
+	server.lock.Lock()
+	onShutdown := server.onShutdown
+	afterShutdown := server.afterShutdown
+	server.lock.Unlock()
+
+	for _, hook := range onShutdown {
+		hook()
+	}
+
+	if server.options.ShutdownDelay > 0 {
+		select {
+		case <-time.After(server.options.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	var errs []error
+	drainCtx, cancel := context.WithTimeout(ctx, server.options.ShutdownTimeout)
+	defer cancel()
+	if err := server.HTTPServer.Shutdown(drainCtx); err != nil {
+		// Close the connections of requests still in flight
+		server.HTTPServer.Close()
+		errs = append(errs, err)
+	}
+
+	// The hooks get time of their own, the requests might have used it all
+	hookCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), server.options.ShutdownTimeout)
+	defer cancel()
+	for _, hook := range afterShutdown {
+		if err := hook(hookCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Listens on a TCP address, or a Unix socket for addresses like
+// "unix:/run/app.sock". Sockets left behind by an earlier process are
+// removed, those in use are not.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("router: %s is in use", path)
+		}
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
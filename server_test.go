@@ -0,0 +1,157 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	aRouter := NewRouter()
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("hello"))
+	})
+
+	server := NewServer(aRouter, ServerOptions{Addrs: []string{"127.0.0.1:0", "unix:" + socket}})
+	var hooks []string
+	server.OnShutdown(func() { hooks = append(hooks, "on") })
+	server.AfterShutdown(func(ctx context.Context) error {
+		hooks = append(hooks, "after")
+		return nil
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- server.Serve(ctx) }()
+
+	clients := []*http.Client{
+		http.DefaultClient,
+		{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		}}},
+	}
+	for _, client := range clients {
+		res, err := client.Get("http://" + server.Addrs()[0].String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "hello" {
+			t.Error("Expected hello got ", string(body))
+		}
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Error("Expected a clean shutdown got ", err)
+	}
+	if len(hooks) != 2 || hooks[0] != "on" || hooks[1] != "after" {
+		t.Error("Expected the hooks to be run in order got ", hooks)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Error("Expected the socket to be removed")
+	}
+}
+
+func TestServerDrains(t *testing.T) {
+	started := make(chan bool)
+	proceed := make(chan bool)
+	aRouter := NewRouter()
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		started <- true
+		<-proceed
+		res.Write([]byte("done"))
+	})
+
+	server := NewServer(aRouter, ServerOptions{Addrs: []string{"127.0.0.1:0"}})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- server.Serve(context.Background()) }()
+
+	responded := make(chan string)
+	go func() {
+		res, err := http.Get("http://" + server.Addrs()[0].String() + "/")
+		if err != nil {
+			responded <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		responded <- string(body)
+	}()
+	<-started
+
+	// Serve is handling the request, so it listens for the signal
+	self, _ := os.FindProcess(os.Getpid())
+	self.Signal(syscall.SIGTERM)
+
+	select {
+	case <-served:
+		t.Fatal("Expected the server to wait for the request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(proceed)
+
+	if body := <-responded; body != "done" {
+		t.Error("Expected the request to finish got ", body)
+	}
+	if err := <-served; err != nil {
+		t.Error("Expected a clean shutdown got ", err)
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	started := make(chan bool)
+	aRouter := NewRouter()
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {
+		started <- true
+		<-req.Context().Done()
+	})
+
+	server := NewServer(aRouter, ServerOptions{
+		Addrs:           []string{"127.0.0.1:0"},
+		ShutdownTimeout: 50 * time.Millisecond,
+	})
+	if err := server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- server.Serve(context.Background()) }()
+
+	go http.Get("http://" + server.Addrs()[0].String() + "/")
+	<-started
+
+	if err := server.Shutdown(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected the shutdown to time out got ", err)
+	}
+	if err := <-served; !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected Serve to report the timeout got ", err)
+	}
+}
+
+func TestListenSocketInUse(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := listen("unix:" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	if _, err := listen("unix:" + socket); err == nil {
+		t.Error("Expected a socket in use not to be taken over")
+	}
+}
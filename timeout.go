@@ -0,0 +1,151 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout
+// --------------------------------
+
+// Timeout returns a HandlerFunc which bounds how long the handlers after it
+// may take to respond.
+//
+// Register it in front of a route's handlers to time out that route, or
+// mount it to time out a group of routes.
+//
+//	appRouter.Get("/report", router.Timeout(2*time.Second, 503), buildReport)
+//	appRouter.Mount("/api", router.Timeout(5*time.Second, 504))
+//
+// The handlers after it receive a request whose context has the deadline
+// set, so they can give up on work via `req.Context().Done()`. Their
+// response is buffered. When the deadline is hit first, the ErrorHandler
+// responds with the given code and whatever they write afterwards is
+// discarded (writes return http.ErrHandlerTimeout). Because of the
+// buffering, handlers after a Timeout can't stream their response.
+//
+// Use `cntxt.TimedOut()` to find out whether the deadline was hit.
+func Timeout(timeout time.Duration, code int) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		cntxt := Context(req)
+
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		// The handlers after us get a request with the deadline set,
+		// make sure they can still find the requestContext.
+		timedReq := req.WithContext(ctx)
+		storeContext(timedReq, cntxt)
+
+		tw := &timeoutWriter{header: res.Header().Clone()}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+
+		// The remaining handlers run in their own goroutine, which might
+		// outlive the request. The last one done releases the context.
+		cntxt.hold()
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+				deleteContext(timedReq)
+				if cntxt.unhold() {
+					releaseContext(cntxt)
+				}
+			}()
+			cntxt.Next(tw, timedReq)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.writeTo(res)
+		case <-ctx.Done():
+			tw.timeout()
+			if ctx.Err() == context.DeadlineExceeded {
+				cntxt.lock.Lock()
+				cntxt.timedOut = true
+				cntxt.lock.Unlock()
+				cntxt.Error(res, req, http.StatusText(code), code)
+				return
+			}
+			// The client went away, stop dispatching handlers.
+			cntxt.Abort()
+		}
+	}
+}
+
+// timeoutWriter buffers the response of the handlers run by Timeout
+// so it can be thrown away once the deadline has been hit.
+type timeoutWriter struct {
+	lock        sync.Mutex
+	header      http.Header
+	body        bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.body.Write(data)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	tw.wroteHeader = true
+	tw.code = code
+}
+
+// Prevents anything from being written once the deadline has been hit.
+func (tw *timeoutWriter) timeout() {
+	tw.lock.Lock()
+	tw.timedOut = true
+	tw.lock.Unlock()
+}
+
+// Copies the buffered response to the actual ResponseWriter.
+func (tw *timeoutWriter) writeTo(res http.ResponseWriter) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	header := res.Header()
+	for key := range header {
+		if _, ok := tw.header[key]; !ok {
+			delete(header, key)
+		}
+	}
+	for key, values := range tw.header {
+		header[key] = values
+	}
+
+	if tw.wroteHeader {
+		res.WriteHeader(tw.code)
+		res.Write(tw.body.Bytes())
+	}
+}
@@ -0,0 +1,125 @@
+package router
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err string, code int) {
+		http.Error(res, "timeout: "+err, code)
+	}
+
+	timedOut := make(chan bool, 1)
+	writeErr := make(chan error, 1)
+	release := make(chan bool)
+
+	logger := func(res http.ResponseWriter, req *http.Request) {
+		Context(req).Next(res, req)
+		timedOut <- Context(req).TimedOut()
+	}
+
+	slowHandler := func(res http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		<-release
+		_, err := res.Write([]byte("too late"))
+		writeErr <- err
+	}
+
+	aRouter.Mount("/", logger)
+	aRouter.Get("/slow", Timeout(20*time.Millisecond, http.StatusServiceUnavailable), slowHandler)
+
+	server := httptest.NewServer(aRouter)
+	defer server.Close()
+
+	res, _ := http.Get(server.URL + "/slow")
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if string(body) != "timeout: Service Unavailable\n" ||
+		res.StatusCode != http.StatusServiceUnavailable {
+		t.Error("Expected 'timeout: Service Unavailable' as response but got ", res.StatusCode, string(body))
+	}
+
+	if !<-timedOut {
+		t.Error("The logger should be able to tell the request timed out")
+	}
+
+	// The handler keeps running after the deadline but can't write anymore
+	close(release)
+	if err := <-writeErr; err != http.ErrHandlerTimeout {
+		t.Error("Expected writes after the deadline to fail with ErrHandlerTimeout but got ", err)
+	}
+}
+
+func TestTimeoutNotHit(t *testing.T) {
+	aRouter := NewRouter()
+
+	timedOut := make(chan bool, 1)
+
+	logger := func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Logger", "yes")
+		Context(req).Next(res, req)
+		timedOut <- Context(req).TimedOut()
+	}
+
+	first := func(res http.ResponseWriter, req *http.Request) {
+		if _, ok := req.Context().Deadline(); !ok {
+			t.Error("The request should have a deadline")
+		}
+		Context(req).Set("user", "richard")
+		Context(req).Next(res, req)
+	}
+
+	second := func(res http.ResponseWriter, req *http.Request) {
+		user, _ := Context(req).Get("user")
+		res.Header().Set("X-User", user.(string))
+		res.WriteHeader(http.StatusCreated)
+		res.Write([]byte("created " + Context(req).Params["userid"]))
+	}
+
+	aRouter.Mount("/", logger)
+	aRouter.Mount("/api", Timeout(time.Second, http.StatusGatewayTimeout))
+	aRouter.Post("/api/user/:userid", first, second)
+
+	server := httptest.NewServer(aRouter)
+	defer server.Close()
+
+	res, _ := http.Post(server.URL+"/api/user/14", "text/plain", nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if string(body) != "created 14" ||
+		res.StatusCode != http.StatusCreated {
+		t.Error("Expected 'created 14' as response but got ", res.StatusCode, string(body))
+	}
+
+	if res.Header.Get("X-Logger") != "yes" ||
+		res.Header.Get("X-User") != "richard" {
+		t.Error("Expected headers set before and after the timeout to be sent, got ", res.Header)
+	}
+
+	if <-timedOut {
+		t.Error("The request should not have timed out")
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	aRouter := NewRouter()
+	aRouter.Get("/", Timeout(time.Second, http.StatusServiceUnavailable), func(res http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	})
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Error("Expected the panic to be passed on, got ", p)
+		}
+	}()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,284 @@
+package router
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracing
+// --------------------------------
+
+// Span is a timed operation of a trace: the handling of a request,
+// or the run of one of its handlers.
+type Span struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	TraceState string                 `json:"trace_state,omitempty"`
+	Sampled    bool                   `json:"-"`
+}
+
+// TraceParent returns the span formatted as a W3C traceparent header,
+// identifying it as the parent of spans in other services.
+func (span *Span) TraceParent() string {
+	flags := "00"
+	if span.Sampled {
+		flags = "01"
+	}
+	return "00-" + span.TraceID + "-" + span.SpanID + "-" + flags
+}
+
+// Exporter sends finished spans to wherever they are collected.
+type Exporter interface {
+	// Export is called with the spans of a request once it has
+	// been handled. The request's span comes first.
+	Export(spans []*Span) error
+}
+
+// JSONExporter writes spans as JSON, one per line.
+type JSONExporter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewJSONExporter creates an exporter writing to w, like os.Stdout.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{w: w}
+}
+
+// Export writes the spans.
+func (exporter *JSONExporter) Export(spans []*Span) error {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+	encoder := json.NewEncoder(exporter.w)
+	for _, span := range spans {
+		if err := encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tracer traces the requests handled by a router. Set it as
+// the router's Tracer.
+//
+//	appRouter.Tracer = &router.Tracer{Exporter: router.NewJSONExporter(os.Stdout)}
+//
+// Every request gets a span named after its method and route. Its
+// handlers each get a child span, nested as they call `cntxt.Next`.
+//
+// The trace is continued from the traceparent and tracestate headers of
+// the request. Use TraceTransport to continue it in other services.
+// Only sampled traces are exported, requests starting a trace are.
+type Tracer struct {
+	Exporter Exporter
+}
+
+// Key of the request's span in the request's context.Context.
+type spanKey struct{}
+
+// SpanFromContext returns the span of the request, nil when
+// the request is not being traced.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Starts the span of the request, returning the request carrying it.
+func (tracer *Tracer) start(cntxt *RequestContext, req *http.Request) *http.Request {
+	span := &Span{
+		SpanID: newSpanID(),
+		Name:   req.Method + " " + cntxt.route,
+		Start:  time.Now(),
+		Attributes: map[string]interface{}{
+			"http.method": req.Method,
+			"http.route":  cntxt.route,
+			"http.target": req.URL.RequestURI(),
+		},
+		Sampled: true,
+	}
+	if traceID, parentID, sampled, ok := parseTraceParent(req.Header.Get("traceparent")); ok {
+		span.TraceID, span.ParentID, span.Sampled = traceID, parentID, sampled
+		span.TraceState = parseTraceState(req.Header.Values("tracestate"))
+	} else {
+		span.TraceID = newTraceID()
+	}
+
+	cntxt.tracer = tracer
+	cntxt.spans = append(cntxt.spans, span)
+	cntxt.activeSpan = span
+	return req.WithContext(context.WithValue(req.Context(), spanKey{}, span))
+}
+
+// Ends the span of the request and exports the spans.
+func (tracer *Tracer) finish(cntxt *RequestContext) {
+	status := cntxt.response.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	// Handlers which timed out might still be running, export copies
+	cntxt.lock.Lock()
+	span := cntxt.spans[0]
+	span.End = time.Now()
+	span.Attributes["http.status_code"] = status
+	spans := make([]*Span, len(cntxt.spans))
+	for i, each := range cntxt.spans {
+		copied := *each
+		spans[i] = &copied
+	}
+	cntxt.lock.Unlock()
+
+	if span.Sampled && tracer.Exporter != nil {
+		tracer.Exporter.Export(spans)
+	}
+}
+
+// Runs a handler in a child span of the active one.
+func (cntxt *RequestContext) traceHandler(handler http.HandlerFunc, res http.ResponseWriter, req *http.Request) {
+	cntxt.lock.Lock()
+	parent := cntxt.activeSpan
+	span := &Span{
+		TraceID:    parent.TraceID,
+		SpanID:     newSpanID(),
+		ParentID:   parent.SpanID,
+		Name:       handlerName(handler),
+		Start:      time.Now(),
+		TraceState: parent.TraceState,
+		Sampled:    parent.Sampled,
+	}
+	cntxt.spans = append(cntxt.spans, span)
+	cntxt.activeSpan = span
+	cntxt.lock.Unlock()
+
+	defer func() {
+		cntxt.lock.Lock()
+		span.End = time.Now()
+		cntxt.activeSpan = parent
+		cntxt.lock.Unlock()
+	}()
+	handler(res, req)
+}
+
+// TraceTransport is an http.RoundTripper continuing the trace in other
+// services by sending the traceparent and tracestate headers. Create
+// outgoing requests with the incoming request's context for it to
+// find the trace.
+//
+//	client := &http.Client{Transport: &router.TraceTransport{}}
+//	outReq, _ := http.NewRequestWithContext(req.Context(), "GET", url, nil)
+//	client.Do(outReq)
+type TraceTransport struct {
+	Base http.RoundTripper // Transport doing the actual request, defaults to http.DefaultTransport
+}
+
+// RoundTrip adds the trace headers and passes the request on.
+func (transport *TraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if span := SpanFromContext(req.Context()); span != nil {
+		// RoundTrippers should not modify the request
+		req = req.Clone(req.Context())
+		req.Header.Set("traceparent", span.TraceParent())
+		if span.TraceState != "" {
+			req.Header.Set("tracestate", span.TraceState)
+		}
+	}
+	return base.RoundTrip(req)
+}
+
+// Parses a traceparent header like
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceParent(header string) (traceID, parentID string, sampled, ok bool) {
+	header = strings.TrimSpace(header)
+	if len(header) < 55 {
+		return
+	}
+	version, traceID, parentID, flags := header[0:2], header[3:35], header[36:52], header[53:55]
+	if header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return
+	}
+	// Later versions may add fields, after a dash
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(header) != 55) ||
+		(len(header) > 55 && header[55] != '-') {
+		return
+	}
+	if !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) ||
+		!isLowerHex(parentID) || parentID == strings.Repeat("0", 16) || !isLowerHex(flags) {
+		return
+	}
+	flagBits, _ := hex.DecodeString(flags)
+	return traceID, parentID, flagBits[0]&1 == 1, true
+}
+
+// Joins the tracestate headers, dropping empty members and
+// those beyond the 32 allowed.
+func parseTraceState(headers []string) string {
+	var members []string
+	for _, header := range headers {
+		for _, member := range strings.Split(header, ",") {
+			member = strings.TrimSpace(member)
+			if member == "" || !strings.Contains(member, "=") {
+				continue
+			}
+			members = append(members, member)
+		}
+	}
+	if len(members) > 32 {
+		members = members[:32]
+	}
+	return strings.Join(members, ",")
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newTraceID() string {
+	return randomHex(16)
+}
+
+func newSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Names the span of a handler after its function, without the
+// package path: "router.AccessLog.func1" or "main.getUser".
+func handlerName(handler http.HandlerFunc) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return "handler"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		name = name[i+1:]
+	}
+	return name
+}
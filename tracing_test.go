@@ -0,0 +1,148 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	type testPair struct {
+		header  string
+		ok      bool
+		sampled bool
+	}
+
+	testPairs := []testPair{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false, false},
+		{"", false, false},
+	}
+
+	for _, test := range testPairs {
+		_, _, sampled, ok := parseTraceParent(test.header)
+		if ok != test.ok || sampled != test.sampled {
+			t.Error("Expected ", test.ok, test.sampled, " got ", ok, sampled, " for ", test.header)
+		}
+	}
+}
+
+// Keeps the exported spans for inspection
+type recordingExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+func (exporter *recordingExporter) Export(spans []*Span) error {
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+	exporter.spans = append(exporter.spans, spans...)
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	received := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		received <- req.Header
+	}))
+	defer backend.Close()
+	client := &http.Client{Transport: &TraceTransport{}}
+
+	exporter := &recordingExporter{}
+	aRouter := NewRouter()
+	aRouter.Tracer = &Tracer{Exporter: exporter}
+	aRouter.Mount("/", traceMountedHandler)
+	aRouter.Get("/user/:userid", func(res http.ResponseWriter, req *http.Request) {
+		outReq, _ := http.NewRequestWithContext(req.Context(), "GET", backend.URL, nil)
+		outRes, err := client.Do(outReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outRes.Body.Close()
+		res.WriteHeader(http.StatusCreated)
+	})
+
+	req, _ := http.NewRequest("GET", "/user/14", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=abc")
+	res := httptest.NewRecorder()
+	aRouter.ServeHTTP(res, req)
+
+	spans := exporter.spans
+	if len(spans) != 3 {
+		t.Fatal("Expected a span for the request and each handler got ", len(spans))
+	}
+	root, mounted, route := spans[0], spans[1], spans[2]
+
+	if root.Name != "GET /user/:userid" || root.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		root.ParentID != "00f067aa0ba902b7" || root.TraceState != "vendor=abc" {
+		t.Error("Expected the trace to be continued got ", root)
+	}
+	if root.Attributes["http.status_code"] != http.StatusCreated || root.End.Before(root.Start) {
+		t.Error("Expected the request span to be finished got ", root)
+	}
+	if mounted.ParentID != root.SpanID || mounted.Name != "router.traceMountedHandler" {
+		t.Error("Expected a span for the mounted handler got ", mounted)
+	}
+	if route.ParentID != mounted.SpanID || route.TraceID != root.TraceID {
+		t.Error("Expected the route handler's span to be nested got ", route)
+	}
+
+	header := <-received
+	if header.Get("traceparent") != "00-4bf92f3577b34da6a3ce929d0e0e4736-"+root.SpanID+"-01" ||
+		header.Get("tracestate") != "vendor=abc" {
+		t.Error("Expected the trace to be passed on got ", header)
+	}
+}
+
+func traceMountedHandler(res http.ResponseWriter, req *http.Request) {
+	Context(req).Next(res, req)
+}
+
+func TestTracerSampling(t *testing.T) {
+	var out bytes.Buffer
+	aRouter := NewRouter()
+	aRouter.Tracer = &Tracer{Exporter: NewJSONExporter(&out)}
+	aRouter.Get("/", func(res http.ResponseWriter, req *http.Request) {})
+
+	// Not sampled by the caller
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	if out.Len() != 0 {
+		t.Error("Expected nothing to be exported got ", out.String())
+	}
+
+	// A new trace
+	req, _ = http.NewRequest("GET", "/", nil)
+	aRouter.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatal("Expected two spans to be exported got ", out.String())
+	}
+	var span struct {
+		TraceID  string `json:"trace_id"`
+		SpanID   string `json:"span_id"`
+		ParentID string `json:"parent_id"`
+		Name     string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &span); err != nil {
+		t.Fatal(err)
+	}
+	if len(span.TraceID) != 32 || len(span.SpanID) != 16 || span.ParentID != "" || span.Name != "GET /" {
+		t.Error("Expected a new root span got ", lines[0])
+	}
+}